@@ -0,0 +1,111 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CleanupPolicySpec defines which clusters a policy applies to and how they are cleaned up.
+type CleanupPolicySpec struct {
+	// NamespaceSelector selects the namespaces of the clusters the policy applies to.
+	// An empty selector matches clusters in all namespaces.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// ClusterSelector selects the clusters the policy applies to by their labels.
+	// An empty selector matches all clusters.
+	// +optional
+	ClusterSelector *metav1.LabelSelector `json:"clusterSelector,omitempty"`
+
+	// Priority decides which policy is used when more than one policy matches a cluster.
+	// The policy with the highest priority wins, ties are broken by name.
+	// +optional
+	Priority int32 `json:"priority,omitempty"`
+
+	// TTL is the time to live of a cluster, counted from its creation. Defaults to 4h.
+	// +optional
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+
+	// WarningLeadTime is how long before the deletion a `ClusterMarkedForDeletion` event is sent. Defaults to 1h.
+	// +optional
+	WarningLeadTime *metav1.Duration `json:"warningLeadTime,omitempty"`
+
+	// MaxAge is the age after which clusters without a `keep-until` label are no longer deleted.
+	// This prevents deletion in case of an accidental deployment to production MCs. Defaults to 168h,
+	// a value of 0 disables the check.
+	// +optional
+	MaxAge *metav1.Duration `json:"maxAge,omitempty"`
+
+	// Ignore lists rules for clusters which are never deleted by this policy.
+	// +optional
+	Ignore []CleanupPolicyIgnoreRule `json:"ignore,omitempty"`
+}
+
+// CleanupPolicyIgnoreRule describes clusters which are ignored for deletion. A cluster is
+// ignored if it matches all of the fields set in the rule.
+type CleanupPolicyIgnoreRule struct {
+	// Namespaces lists the namespaces of ignored clusters.
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// ClusterSelector selects ignored clusters by their labels.
+	// +optional
+	ClusterSelector *metav1.LabelSelector `json:"clusterSelector,omitempty"`
+}
+
+// CleanupPolicyStatus defines the observed state of CleanupPolicy.
+type CleanupPolicyStatus struct {
+	// MatchedClusters is the number of clusters currently governed by the policy, i.e. matched by its selectors and
+	// not by a policy with a higher priority.
+	// +optional
+	MatchedClusters int32 `json:"matchedClusters"`
+
+	// ObservedGeneration is the last generation of the policy the status was computed for.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster,categories=giantswarm
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="TTL",type=string,JSONPath=`.spec.ttl`
+// +kubebuilder:printcolumn:name="Priority",type=integer,JSONPath=`.spec.priority`
+// +kubebuilder:printcolumn:name="Matched",type=integer,JSONPath=`.status.matchedClusters`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// CleanupPolicy configures the cleanup of the clusters it selects.
+type CleanupPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CleanupPolicySpec   `json:"spec,omitempty"`
+	Status CleanupPolicyStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// CleanupPolicyList contains a list of CleanupPolicy.
+type CleanupPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CleanupPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CleanupPolicy{}, &CleanupPolicyList{})
+}
@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/labels"
+	capi "sigs.k8s.io/cluster-api/api/core/v1beta2"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	cleanerv1alpha1 "github.com/giantswarm/cluster-cleaner/api/v1alpha1"
+	"github.com/giantswarm/cluster-cleaner/pkg/policy"
+)
+
+// resolveSettings returns the settings of the CleanupPolicy with the highest priority matching the cluster.
+// The default settings are returned if no policy matches or the CleanupPolicy CRD is not installed.
+func resolveSettings(ctx context.Context, client ctrlclient.Client, cluster *capi.Cluster) (policy.Settings, error) {
+	policies := &cleanerv1alpha1.CleanupPolicyList{}
+	if err := client.List(ctx, policies); err != nil {
+		if meta.IsNoMatchError(err) {
+			return policy.DefaultSettings(), nil
+		}
+		return policy.Settings{}, errors.Wrap(err, "failed listing cleanup policies")
+	}
+	if len(policies.Items) == 0 {
+		return policy.DefaultSettings(), nil
+	}
+
+	namespaceLabels, err := getNamespaceLabels(ctx, client, cluster.Namespace)
+	if err != nil {
+		return policy.Settings{}, err
+	}
+
+	return policy.ResolveSettings(cluster, policies.Items, namespaceLabels)
+}
+
+func getNamespaceLabels(ctx context.Context, client ctrlclient.Client, name string) (labels.Set, error) {
+	namespace := &corev1.Namespace{}
+	if err := client.Get(ctx, ctrlclient.ObjectKey{Name: name}, namespace); err != nil {
+		if apierrors.IsNotFound(err) {
+			return labels.Set{}, nil
+		}
+		return nil, errors.Wrapf(err, "failed getting namespace %s", name)
+	}
+
+	return namespace.Labels, nil
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"slices"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	capi "sigs.k8s.io/cluster-api/api/core/v1beta2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	cleanerv1alpha1 "github.com/giantswarm/cluster-cleaner/api/v1alpha1"
+	"github.com/giantswarm/cluster-cleaner/pkg/policy"
+)
+
+// CleanupPolicyReconciler keeps the status of CleanupPolicy objects up to date.
+type CleanupPolicyReconciler struct {
+	ctrlclient.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=cluster-cleaner.giantswarm.io,resources=cleanuppolicies,verbs=get;list;watch
+// +kubebuilder:rbac:groups=cluster-cleaner.giantswarm.io,resources=cleanuppolicies/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+
+func (r *CleanupPolicyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("cleanuppolicy", req.Name)
+
+	cleanupPolicy := &cleanerv1alpha1.CleanupPolicy{}
+	if err := r.Get(ctx, req.NamespacedName, cleanupPolicy); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+
+		return ctrl.Result{}, err
+	}
+
+	policies := &cleanerv1alpha1.CleanupPolicyList{}
+	if err := r.List(ctx, policies); err != nil {
+		return ctrl.Result{}, errors.Wrap(err, "failed listing cleanup policies")
+	}
+
+	clusters := &capi.ClusterList{}
+	if err := r.List(ctx, clusters); err != nil {
+		return ctrl.Result{}, errors.Wrap(err, "failed listing clusters")
+	}
+
+	namespaces := &corev1.NamespaceList{}
+	if err := r.List(ctx, namespaces); err != nil {
+		return ctrl.Result{}, errors.Wrap(err, "failed listing namespaces")
+	}
+	namespaceLabels := map[string]labels.Set{}
+	for _, ns := range namespaces.Items {
+		namespaceLabels[ns.Name] = ns.Labels
+	}
+
+	// count only the clusters governed by this policy, not the ones a policy with a higher priority also selects
+	var matched int32
+	for i := range clusters.Items {
+		s, err := policy.ResolveSettings(&clusters.Items[i], policies.Items, namespaceLabels[clusters.Items[i].Namespace])
+		if err != nil {
+			log.Error(err, "failed resolving cleanup policy")
+			return ctrl.Result{}, nil
+		}
+		if s.Policy == cleanupPolicy.Name {
+			matched++
+		}
+	}
+
+	if cleanupPolicy.Status.MatchedClusters == matched && cleanupPolicy.Status.ObservedGeneration == cleanupPolicy.Generation {
+		return ctrl.Result{}, nil
+	}
+
+	cleanupPolicy.Status.MatchedClusters = matched
+	cleanupPolicy.Status.ObservedGeneration = cleanupPolicy.Generation
+	if err := r.Status().Update(ctx, cleanupPolicy); err != nil {
+		return ctrl.Result{}, errors.Wrap(err, "failed updating cleanup policy status")
+	}
+	log.Info("Updated matched clusters", "matchedClusters", matched)
+
+	return ctrl.Result{}, nil
+}
+
+// allPolicies enqueues all CleanupPolicy objects, as a changed cluster or policy might change which clusters any of
+// them governs.
+func (r *CleanupPolicyReconciler) allPolicies(ctx context.Context, _ ctrlclient.Object) []reconcile.Request {
+	policies := &cleanerv1alpha1.CleanupPolicyList{}
+	if err := r.List(ctx, policies); err != nil {
+		r.Log.Error(err, "failed listing cleanup policies")
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(policies.Items))
+	for _, p := range policies.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: ctrlclient.ObjectKeyFromObject(&p)})
+	}
+
+	return requests
+}
+
+// namespaceToPolicies enqueues all CleanupPolicy objects if any of them has a namespace selector, as the changed
+// namespace labels might change which policy governs the clusters in the namespace.
+func (r *CleanupPolicyReconciler) namespaceToPolicies(ctx context.Context, _ ctrlclient.Object) []reconcile.Request {
+	policies := &cleanerv1alpha1.CleanupPolicyList{}
+	if err := r.List(ctx, policies); err != nil {
+		r.Log.Error(err, "failed listing cleanup policies")
+		return nil
+	}
+
+	namespaced := slices.ContainsFunc(policies.Items, func(p cleanerv1alpha1.CleanupPolicy) bool {
+		return p.Spec.NamespaceSelector != nil
+	})
+	if !namespaced {
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(policies.Items))
+	for _, p := range policies.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: ctrlclient.ObjectKeyFromObject(&p)})
+	}
+
+	return requests
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *CleanupPolicyReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	err := ctrl.NewControllerManagedBy(mgr).
+		For(&cleanerv1alpha1.CleanupPolicy{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(
+			&cleanerv1alpha1.CleanupPolicy{},
+			handler.EnqueueRequestsFromMapFunc(r.allPolicies),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}),
+		).
+		Watches(
+			&capi.Cluster{},
+			handler.EnqueueRequestsFromMapFunc(r.allPolicies),
+			builder.WithPredicates(predicate.LabelChangedPredicate{}),
+		).
+		Watches(
+			&corev1.Namespace{},
+			handler.EnqueueRequestsFromMapFunc(r.namespaceToPolicies),
+			builder.WithPredicates(predicate.LabelChangedPredicate{}),
+		).
+		Complete(r)
+	if err != nil {
+		return errors.Wrap(err, "failed setting up with a controller manager")
+	}
+
+	return nil
+}
@@ -0,0 +1,368 @@
+package controllers
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	testingclock "k8s.io/utils/clock/testing"
+	capi "sigs.k8s.io/cluster-api/api/core/v1beta2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	cleanerv1alpha1 "github.com/giantswarm/cluster-cleaner/api/v1alpha1"
+)
+
+func TestClusterControllerWithCleanupPolicy(t *testing.T) {
+	now := time.Date(2022, 2, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name             string
+		expectedDeletion bool
+
+		cluster  *capi.Cluster
+		policies []*cleanerv1alpha1.CleanupPolicy
+	}{
+		// policy with a longer TTL keeps the cluster
+		{
+			name:             "case 0 - longer ttl",
+			expectedDeletion: false,
+
+			cluster: newTestCluster("test", "default", now.Add(-defaultTTL), nil),
+			policies: []*cleanerv1alpha1.CleanupPolicy{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "long"},
+					Spec: cleanerv1alpha1.CleanupPolicySpec{
+						TTL: &metav1.Duration{Duration: 8 * time.Hour},
+					},
+				},
+			},
+		},
+		// policy with a shorter TTL deletes the cluster
+		{
+			name:             "case 1 - shorter ttl",
+			expectedDeletion: true,
+
+			cluster: newTestCluster("test", "default", now.Add(-2*time.Hour), nil),
+			policies: []*cleanerv1alpha1.CleanupPolicy{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "short"},
+					Spec: cleanerv1alpha1.CleanupPolicySpec{
+						TTL: &metav1.Duration{Duration: 1 * time.Hour},
+					},
+				},
+			},
+		},
+		// policy selecting other clusters is not applied
+		{
+			name:             "case 2 - selector does not match",
+			expectedDeletion: true,
+
+			cluster: newTestCluster("test", "default", now.Add(-defaultTTL), nil),
+			policies: []*cleanerv1alpha1.CleanupPolicy{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "long"},
+					Spec: cleanerv1alpha1.CleanupPolicySpec{
+						ClusterSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}},
+						TTL:             &metav1.Duration{Duration: 8 * time.Hour},
+					},
+				},
+			},
+		},
+		// policy with the highest priority wins
+		{
+			name:             "case 3 - priority",
+			expectedDeletion: false,
+
+			cluster: newTestCluster("test", "default", now.Add(-defaultTTL), map[string]string{"team": "a"}),
+			policies: []*cleanerv1alpha1.CleanupPolicy{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "a-short"},
+					Spec: cleanerv1alpha1.CleanupPolicySpec{
+						TTL: &metav1.Duration{Duration: 1 * time.Hour},
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "b-long"},
+					Spec: cleanerv1alpha1.CleanupPolicySpec{
+						ClusterSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}},
+						Priority:        10,
+						TTL:             &metav1.Duration{Duration: 8 * time.Hour},
+					},
+				},
+			},
+		},
+		// ignore rule of the policy matches
+		{
+			name:             "case 4 - ignore rule",
+			expectedDeletion: false,
+
+			cluster: newTestCluster("test", "default", now.Add(-defaultTTL), map[string]string{"team": "a"}),
+			policies: []*cleanerv1alpha1.CleanupPolicy{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "ignore"},
+					Spec: cleanerv1alpha1.CleanupPolicySpec{
+						Ignore: []cleanerv1alpha1.CleanupPolicyIgnoreRule{
+							{
+								Namespaces:      []string{"default"},
+								ClusterSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}},
+							},
+						},
+					},
+				},
+			},
+		},
+		// shorter max age protects the cluster
+		{
+			name:             "case 5 - max age",
+			expectedDeletion: false,
+
+			cluster: newTestCluster("test", "default", now.Add(-2*defaultTTL), nil),
+			policies: []*cleanerv1alpha1.CleanupPolicy{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "max-age"},
+					Spec: cleanerv1alpha1.CleanupPolicySpec{
+						MaxAge: &metav1.Duration{Duration: defaultTTL},
+					},
+				},
+			},
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			fakeClientBuilder := fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(tc.cluster)
+			for _, p := range tc.policies {
+				fakeClientBuilder = fakeClientBuilder.WithObjects(p)
+			}
+			fakeClient := fakeClientBuilder.Build()
+			r := &ClusterReconciler{
+				Client:   fakeClient,
+				Scheme:   fakeScheme,
+				Log:      ctrl.Log.WithName("fake"),
+				recorder: record.NewFakeRecorder(1),
+				Clock:    testingclock.NewFakePassiveClock(now),
+			}
+			ctx := context.TODO()
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(tc.cluster)})
+			if err != nil {
+				t.Error(err)
+			}
+
+			obj := &capi.Cluster{}
+			err = fakeClient.Get(ctx, client.ObjectKeyFromObject(tc.cluster), obj)
+			if err != nil {
+				t.Error(err)
+			}
+			assert.Equal(t, tc.expectedDeletion, obj.DeletionTimestamp != nil, "test case %v failed.", tc.name)
+		})
+	}
+}
+
+func TestCleanupPolicyStatus(t *testing.T) {
+	testCases := []struct {
+		name                    string
+		policies                []*cleanerv1alpha1.CleanupPolicy
+		expectedMatchedClusters int32
+	}{
+		{
+			name: "case 0 - namespace and cluster selector",
+			policies: []*cleanerv1alpha1.CleanupPolicy{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "test"},
+					Spec: cleanerv1alpha1.CleanupPolicySpec{
+						NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "test"}},
+						ClusterSelector:   &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}},
+					},
+				},
+			},
+			expectedMatchedClusters: 2,
+		},
+		// clusters governed by a policy with a higher priority are not counted
+		{
+			name: "case 1 - higher priority policy",
+			policies: []*cleanerv1alpha1.CleanupPolicy{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "test"},
+					Spec: cleanerv1alpha1.CleanupPolicySpec{
+						NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "test"}},
+						ClusterSelector:   &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}},
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "priority"},
+					Spec: cleanerv1alpha1.CleanupPolicySpec{
+						ClusterSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"priority": "high"}},
+						Priority:        10,
+					},
+				},
+			},
+			expectedMatchedClusters: 1,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			fakeClientBuilder := fake.NewClientBuilder().
+				WithScheme(fakeScheme).
+				WithStatusSubresource(&cleanerv1alpha1.CleanupPolicy{}).
+				WithObjects(
+					&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "org-a", Labels: map[string]string{"env": "test"}}},
+					&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "org-b"}},
+					newTestCluster("one", "org-a", time.Now(), map[string]string{"team": "a"}),
+					newTestCluster("two", "org-a", time.Now(), map[string]string{"team": "a", "priority": "high"}),
+					newTestCluster("three", "org-a", time.Now(), map[string]string{"team": "b"}),
+					newTestCluster("four", "org-b", time.Now(), map[string]string{"team": "a"}),
+				)
+			for _, p := range tc.policies {
+				fakeClientBuilder = fakeClientBuilder.WithObjects(p)
+			}
+			fakeClient := fakeClientBuilder.Build()
+			r := &CleanupPolicyReconciler{
+				Client: fakeClient,
+				Scheme: fakeScheme,
+				Log:    ctrl.Log.WithName("fake"),
+			}
+
+			ctx := context.TODO()
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "test"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			obj := &cleanerv1alpha1.CleanupPolicy{}
+			err = fakeClient.Get(ctx, types.NamespacedName{Name: "test"}, obj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.expectedMatchedClusters, obj.Status.MatchedClusters, "test case %v failed.", tc.name)
+		})
+	}
+}
+
+func TestNamespaceToPolicies(t *testing.T) {
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(fakeScheme).
+		WithObjects(
+			&cleanerv1alpha1.CleanupPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "namespaced"},
+				Spec: cleanerv1alpha1.CleanupPolicySpec{
+					NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "test"}},
+				},
+			},
+			&cleanerv1alpha1.CleanupPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "clusters"},
+				Spec: cleanerv1alpha1.CleanupPolicySpec{
+					ClusterSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}},
+				},
+			},
+		).
+		Build()
+	r := &CleanupPolicyReconciler{
+		Client: fakeClient,
+		Scheme: fakeScheme,
+		Log:    ctrl.Log.WithName("fake"),
+	}
+
+	requests := r.namespaceToPolicies(context.TODO(), &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "org-a"}})
+	assert.ElementsMatch(t, []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Name: "namespaced"}},
+		{NamespacedName: types.NamespacedName{Name: "clusters"}},
+	}, requests)
+
+	// without namespace selectors the namespace labels do not change which clusters the policies govern
+	r.Client = fake.NewClientBuilder().
+		WithScheme(fakeScheme).
+		WithObjects(&cleanerv1alpha1.CleanupPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "clusters"},
+			Spec: cleanerv1alpha1.CleanupPolicySpec{
+				ClusterSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}},
+			},
+		}).
+		Build()
+	requests = r.namespaceToPolicies(context.TODO(), &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "org-a"}})
+	assert.Empty(t, requests)
+}
+
+func TestClusterRequests(t *testing.T) {
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(fakeScheme).
+		WithObjects(
+			newTestCluster("a", "org-a", time.Now(), nil),
+			newTestCluster("b", "org-a", time.Now(), nil),
+			newTestCluster("c", "org-b", time.Now(), nil),
+		).
+		Build()
+	r := &ClusterReconciler{
+		Client: fakeClient,
+		Scheme: fakeScheme,
+		Log:    ctrl.Log.WithName("fake"),
+	}
+
+	testCases := []struct {
+		name             string
+		mapFunc          func(context.Context, client.Object) []reconcile.Request
+		object           client.Object
+		expectedRequests []reconcile.Request
+	}{
+		{
+			name:    "case 0 - cleanup policy changed",
+			mapFunc: r.policyToClusters,
+			object:  &cleanerv1alpha1.CleanupPolicy{ObjectMeta: metav1.ObjectMeta{Name: "long-lived"}},
+			expectedRequests: []reconcile.Request{
+				{NamespacedName: types.NamespacedName{Name: "a", Namespace: "org-a"}},
+				{NamespacedName: types.NamespacedName{Name: "b", Namespace: "org-a"}},
+				{NamespacedName: types.NamespacedName{Name: "c", Namespace: "org-b"}},
+			},
+		},
+		{
+			name:    "case 1 - namespace labels changed",
+			mapFunc: r.namespaceToClusters,
+			object:  &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "org-a"}},
+			expectedRequests: []reconcile.Request{
+				{NamespacedName: types.NamespacedName{Name: "a", Namespace: "org-a"}},
+				{NamespacedName: types.NamespacedName{Name: "b", Namespace: "org-a"}},
+			},
+		},
+		{
+			name:             "case 2 - namespace without clusters",
+			mapFunc:          r.namespaceToClusters,
+			object:           &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "org-c"}},
+			expectedRequests: []reconcile.Request{},
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			requests := tc.mapFunc(context.TODO(), tc.object)
+			assert.ElementsMatch(t, tc.expectedRequests, requests, "test case %v failed.", tc.name)
+		})
+	}
+}
+
+func newTestCluster(name, namespace string, creationTimestamp time.Time, labels map[string]string) *capi.Cluster {
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels["cluster-operator.giantswarm.io/version"] = "5.1.1"
+
+	return &capi.Cluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			CreationTimestamp: metav1.Time{
+				Time: creationTimestamp,
+			},
+			Labels:      labels,
+			Annotations: map[string]string{},
+			Finalizers: []string{
+				"operatorkit.giantswarm.io/cluster-operator-cluster-controller",
+			},
+		},
+	}
+}
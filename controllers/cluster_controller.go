@@ -32,9 +32,19 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/selection"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/clock"
 	capi "sigs.k8s.io/cluster-api/api/core/v1beta2"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	cleanerv1alpha1 "github.com/giantswarm/cluster-cleaner/api/v1alpha1"
+	"github.com/giantswarm/cluster-cleaner/pkg/notification"
+	"github.com/giantswarm/cluster-cleaner/pkg/policy"
+	recordutil "github.com/giantswarm/cluster-cleaner/util/record"
 )
 
 // ClusterReconciler reconciles a Cluster object
@@ -44,7 +54,29 @@ type ClusterReconciler struct {
 	Scheme *runtime.Scheme
 	DryRun bool
 
-	recorder record.EventRecorder
+	Options
+
+	// Clock is the source of the current time. The real time is used if it is not set.
+	Clock clock.PassiveClock
+
+	// Notifier receives notifications about the decisions made for clusters. Notifications are not sent if it is not set.
+	Notifier notification.Notifier
+
+	// Messages renders the messages of events and notifications. The default messages are used if it is not set.
+	Messages *Messages
+
+	// EventDeduplicationWindow is how long an identical event about the same object is not recorded again.
+	// Events are not deduplicated if it is zero.
+	EventDeduplicationWindow time.Duration
+
+	// MetricsRetention is how long the counter series of a cluster are kept after it is gone, so its final values
+	// can still be scraped. The series are deleted right away if it is zero.
+	MetricsRetention time.Duration
+
+	recorder  record.EventRecorder
+	notified  notificationStates
+	series    counterSeries
+	deletions deletionStarts
 }
 
 // +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters,verbs=get;list;watch;create;update;patch;delete
@@ -58,161 +90,280 @@ func (r *ClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 	cluster := &capi.Cluster{}
 	if err := r.Get(ctx, req.NamespacedName, cluster); err != nil {
 		if apierrors.IsNotFound(err) {
+			now := currentTime(r.Clock)
+			if started, ok := r.deletions.finish(req.NamespacedName); ok {
+				DeletionDuration.Observe(now.Sub(started).Seconds())
+			}
+			r.notified.forget(req.NamespacedName)
+			deleteClusterMetrics(req.NamespacedName)
+			// requeue the cluster to delete its counter series once the retention period has passed
+			if left, ok := r.series.retain(req.NamespacedName, now, r.MetricsRetention); ok {
+				return ctrl.Result{RequeueAfter: left}, nil
+			}
 			return ctrl.Result{}, nil
 		}
 
 		return ctrl.Result{}, err
 	}
+	r.series.seen(req.NamespacedName)
 
 	return r.reconcile(ctx, cluster, log)
 }
 
 func (r *ClusterReconciler) reconcile(ctx context.Context, cluster *capi.Cluster, log logr.Logger) (ctrl.Result, error) {
+	now := currentTime(r.Clock)
+
 	// ignore cluster deletion if timestamp is not nil or zero
 	if !cluster.DeletionTimestamp.IsZero() {
 		PendingTotal.WithLabelValues(cluster.Name, cluster.Namespace).Inc()
-		log.Info("Deletion for cluster is already applied")
+		r.recordDecision(log, cluster, policy.EvaluateSettings(cluster, nil, policy.DefaultSettings(), now, r.Config), now)
 		return ctrl.Result{}, nil
 	}
 
-	// ignore GitOps-managed resources
-	if _, ok := cluster.Labels[fluxLabel]; ok {
-		IgnoredTotal.WithLabelValues(cluster.Name, cluster.Namespace).Inc()
-		log.Info(fmt.Sprintf("Found label %s. Cluster will be ignored for deletion", fluxLabel))
-		return ctrl.Result{}, nil
+	s, err := resolveSettings(ctx, r.Client, cluster)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if s.Policy != "" {
+		log = log.WithValues("policy", s.Policy)
 	}
 
-	// ignore cluster from being deleted if ignore annotation is set
-	if _, ok := cluster.Annotations[ignoreClusterDeletion]; ok {
-		IgnoredTotal.WithLabelValues(cluster.Name, cluster.Namespace).Inc()
-		log.Info(fmt.Sprintf("Found annotation %s. Cluster will be ignored for deletion", ignoreClusterDeletion))
-		return ctrl.Result{}, nil
+	// keep the delete-after annotation up to date when keep-until or TTL settings change or the cluster is extended
+	if !r.DryRun {
+		if err := r.applyExtension(ctx, log, cluster, s, now); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		if err := r.updateKeepUntilObservedAnnotation(ctx, cluster, now); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	owner, err := r.updateOwnerAnnotation(ctx, cluster)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if owner != "" {
+		log = log.WithValues("owner", owner)
+		setOwnerMetric(cluster, owner)
 	}
 
-	// check if cluster has a keep-until label with a valid ISO date string
-	if v, ok := cluster.Labels[keepUntil]; ok {
-		t, err := time.Parse(keepUntilTimeLayout, v)
-		if err != nil {
-			ErrorsTotal.WithLabelValues(cluster.Name, cluster.Namespace).Inc()
-			log.Error(err, "failed to parse keep-until label value for cluster")
-			return ctrl.Result{}, nil
+	app, err := getClusterApp(ctx, r.Client, cluster)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	d := policy.EvaluateSettings(cluster, app, s, now, r.Config)
+	deadline, hasDeadline := d.Deadline, !d.Deadline.IsZero()
+	if !r.DryRun {
+		if err := r.updateDeleteAfterAnnotation(ctx, cluster, deadline, hasDeadline); err != nil {
+			return ctrl.Result{}, err
 		}
-		if time.Now().UTC().Before(t.AddDate(0, 0, 1)) {
-			IgnoredTotal.WithLabelValues(cluster.Name, cluster.Namespace).Inc()
-			log.Info(fmt.Sprintf("Found label %s. Cluster will be ignored for deletion", keepUntil))
-			return ctrl.Result{RequeueAfter: 24 * time.Hour}, nil
+	}
+	r.recordDecision(log, cluster, d, now)
+
+	if d.Ignored() {
+		IgnoredTotal.WithLabelValues(cluster.Name, cluster.Namespace).Inc()
+	}
+	if d.Reason != policy.DecisionIgnoreAnnotation {
+		IgnoredTooLong.DeleteLabelValues(cluster.Name, cluster.Namespace)
+	}
+	if d.InvalidTTL != nil {
+		ErrorsTotal.WithLabelValues(cluster.Name, cluster.Namespace).Inc()
+	}
+	if d.InvalidKeepUntil != nil {
+		ErrorsTotal.WithLabelValues(cluster.Name, cluster.Namespace).Inc()
+		InvalidKeepUntil.WithLabelValues(cluster.Name, cluster.Namespace).Set(1)
+		if !r.DryRun {
+			r.submitInvalidKeepUntilEvent(ctx, cluster, d.InvalidKeepUntil, now)
 		}
 	} else {
-		// ignore cluster from being deleted if it is older than 7 days and do NOT have keep-until label
-		// this is to prevent deletion in a case of accidental deployment of the app to production MCs
-		if time.Since(cluster.CreationTimestamp.Time).Hours() > 24*7 {
-			log.Info(fmt.Sprintf("Cluster is older than 7 days and does not have label %s. Cluster will be ignored for deletion", keepUntil))
-			return ctrl.Result{}, nil
+		InvalidKeepUntil.DeleteLabelValues(cluster.Name, cluster.Namespace)
+	}
+	if d.KeepUntilClamped && !r.DryRun {
+		r.event(ctx, cluster, corev1.EventTypeWarning, messageKeepUntilClamped, d.KeepUntil, now, messageFields{
+			Source:  d.KeepUntilSource,
+			Horizon: r.MaxKeepUntilHorizon,
+			Basis:   r.maxKeepUntilBasis(),
+		})
+	}
+
+	switch d.Reason {
+	case policy.DecisionFluxManaged:
+		r.notifyIgnored(cluster, ignoredReasonFlux, time.Time{}, d.Detail, now)
+		return ctrl.Result{}, nil
+
+	case policy.DecisionIgnoreAnnotation:
+		r.checkIgnoredTooLong(ctx, cluster, now)
+		if d.IgnoreExpiry.IsZero() {
+			r.notifyIgnored(cluster, ignoredReasonAnnotation, time.Time{}, d.Detail, now)
+			return r.ignoredRequeue(cluster, time.Time{}, now), nil
 		}
+		r.notifyIgnored(cluster, ignoredReasonAnnotation, deadline, d.Detail, now)
 
-	}
+		// the cluster is deleted once the annotation expired, so warn about it in advance
+		next := d.IgnoreExpiry
+		if hasDeadline {
+			if err := r.sendWarnings(ctx, log, cluster, deadline, policy.WarningStages(s, r.Config), now); err != nil {
+				return ctrl.Result{}, err
+			}
+			if scheduled, ok := nextReconcile(cluster, s, r.Options, now); ok && scheduled.Before(next) {
+				next = scheduled
+			}
+		}
+		return r.ignoredRequeue(cluster, next, now), nil
 
-	// immediately delete the cluster if defaultTTL has passed
-	if deletionTimeReached(cluster) {
+	case policy.DecisionIgnoreRule:
+		r.notifyIgnored(cluster, ignoredReasonPolicy, time.Time{}, d.Detail, now)
+		return ctrl.Result{}, nil
+
+	case policy.DecisionDeleteNow:
+		log = log.WithValues("requester", d.Detail)
+		r.notified.forget(ctrlKey(cluster), notification.KindIgnored)
 		if !r.DryRun {
-			// if it's a vintage cluster, we just try to remove the Cluster CR
-			if _, ok := cluster.Labels[clusterOperatorVersion]; ok {
-				err := deleteVintageCluster(ctx, log, r.Client, cluster)
-				if err != nil {
-					return ctrl.Result{}, err
-				}
-			} else {
-				err := deleteClusterApp(ctx, log, r.Client, cluster)
-				if err != nil {
-					return ctrl.Result{}, err
-				}
+			r.event(ctx, cluster, corev1.EventTypeNormal, messageDeletionRequested, deadline, now, messageFields{Requester: d.Detail})
+			if err := r.deleteCluster(ctx, log, cluster, app, deadline, now, d.Detail); err != nil {
+				return ctrl.Result{}, err
 			}
 		} else {
-			log.Info("DryRun: skipping sending deletion event for cluster")
+			log.Info("DryRun: skipping deletion of cluster")
 		}
+		return ctrl.Result{}, nil
+
+	case policy.DecisionInvalidKeepUntil:
+		r.notifyIgnored(cluster, ignoredReasonInvalidKeepUntil, time.Time{}, d.Detail, now)
+		return ctrl.Result{RequeueAfter: invalidKeepUntilRequeue}, nil
+
+	case policy.DecisionKeepUntil:
+		r.notified.forget(ctrlKey(cluster), notification.KindIgnored)
+		if hasDeadline {
+			if err := r.sendWarnings(ctx, log, cluster, deadline, policy.WarningStages(s, r.Config), now); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		return scheduledRequeue(cluster, s, r.Options, now), nil
+
+	case policy.DecisionTooOld:
+		r.notifyIgnored(cluster, ignoredReasonMaxAge, time.Time{}, d.Detail, now)
+		return ctrl.Result{}, nil
 
+	case policy.DecisionNoChartAnnotation, policy.DecisionNoApp:
 		return ctrl.Result{}, nil
 	}
+	r.notified.forget(ctrlKey(cluster), notification.KindIgnored)
 
-	// only send marked for deletion event if we still have ~1h before the cluster gets deleted
-	if deletionEventTimeReached(cluster) {
+	if d.Reason == policy.DecisionDeleted {
 		if !r.DryRun {
-			log.Info("Cluster is marked for deletion")
-			r.submitClusterDeletionEvent(cluster, fmt.Sprintf("Cluster will be deleted in aprox. %v min.", deletionTime(cluster)))
+			if err := r.deleteCluster(ctx, log, cluster, app, deadline, now, ""); err != nil {
+				return ctrl.Result{}, err
+			}
 		} else {
-			log.Info("DryRun: skipping sending deletion event for cluster")
+			log.Info("DryRun: skipping deletion of cluster")
+		}
+		return ctrl.Result{}, nil
+	}
+
+	// send a marked for deletion event for each warning stage (1h before the deletion by default) reached
+	if hasDeadline {
+		if err := r.sendWarnings(ctx, log, cluster, deadline, policy.WarningStages(s, r.Config), now); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// requeue exactly when the next warning stage is reached or the cluster is due for deletion
+	return scheduledRequeue(cluster, s, r.Options, now), nil
+}
+
+// recordDecision logs the decision made for the cluster in a single line and updates the decision and state metrics.
+func (r *ClusterReconciler) recordDecision(log logr.Logger, cluster *capi.Cluster, d policy.Decision, now time.Time) {
+	log.Info("Cluster evaluated", decisionLogValues(d)...)
+	DecisionsTotal.WithLabelValues(string(d.Reason)).Inc()
+	setStateMetrics(cluster, clusterState(d), d.Deadline, now)
+}
+
+// deleteCluster deletes a vintage cluster CR, or the App CRs of a CAPI-based cluster. A notification is sent once the
+// deletion was started, naming the requester of the deletion if there is one, or when it failed. The age of the
+// cluster and the delay after its deadline are observed when the deletion is started the first time.
+func (r *ClusterReconciler) deleteCluster(ctx context.Context, log logr.Logger, cluster *capi.Cluster, app *gsapplication.App, deadline, now time.Time, requester string) error {
+	var deleted bool
+	var err error
+	// if it's a vintage cluster, we just try to remove the Cluster CR
+	if _, ok := cluster.Labels[clusterOperatorVersion]; ok {
+		deleted, err = deleteVintageCluster(ctx, log, r.Client, cluster)
+	} else {
+		deleted, err = deleteClusterApp(ctx, log, r.Client, cluster, app)
+	}
+
+	if deleted {
+		message := r.message(messageDeleted, cluster, time.Time{}, now, messageFields{})
+		if requester != "" {
+			message = r.message(messageDeletionRequested, cluster, time.Time{}, now, messageFields{Requester: requester})
+		}
+		r.notify(newNotification(cluster, notification.KindDeleted, message, now))
+		r.notified.forget(ctrlKey(cluster), notification.KindFailed)
+		setStateMetrics(cluster, stateDeleting, time.Time{}, now)
+		if r.deletions.start(ctrlKey(cluster), now) {
+			AgeAtDeletion.Observe(now.Sub(policy.CreationTime(cluster)).Seconds())
+			if !deadline.IsZero() {
+				DeletionDelay.Observe(max(now.Sub(deadline), 0).Seconds())
+			}
 		}
-		return ctrl.Result{
-			RequeueAfter: 1 * time.Hour,
-		}, nil
+	} else if err != nil {
+		r.event(ctx, cluster, corev1.EventTypeWarning, messageFailed, time.Time{}, now, messageFields{Error: err.Error()})
+		r.notifyFailed(cluster, err, now)
 	}
 
-	return requeue(), nil
+	return err
 }
 
-func deleteVintageCluster(ctx context.Context, log logr.Logger, client ctrlclient.Client, cluster *capi.Cluster) error {
+func deleteVintageCluster(ctx context.Context, log logr.Logger, client ctrlclient.Client, cluster *capi.Cluster) (bool, error) {
 	log.Info("Cluster is being deleted")
 	if err := client.Delete(ctx, cluster, ctrlclient.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil {
 		log.Error(err, "unable to delete cluster")
 		ErrorsTotal.WithLabelValues(cluster.Name, cluster.Namespace).Inc()
-		return err
+		return false, err
 	}
 	log.Info("Cluster was deleted")
 	SuccessTotal.WithLabelValues(cluster.Name, cluster.Namespace).Inc()
-	return nil
+	return true, nil
 }
 
-func deleteClusterApp(ctx context.Context, log logr.Logger, client ctrlclient.Client, cluster *capi.Cluster) error {
-	// CAPI-based cluster but without Helm annotation? weird! should not happen; if do, we have log it
-	if !hasChartAnnotations(cluster) {
-		IgnoredTotal.WithLabelValues(cluster.Name, cluster.Namespace).Inc()
-		log.Info("Chart annotation not found for CAPI-based cluster. Cluster will be ignored for deletion")
-		return nil
-	}
-
-	app := &gsapplication.App{}
-	if err := client.Get(ctx, getClusterAppNamespacedName(cluster), app); err != nil {
-		if apierrors.IsNotFound(err) {
-			return nil
+// deleteClusterApp deletes the App CRs and ConfigMaps of a CAPI-based cluster, given its App CR. Clusters without App
+// CR or with a GitOps-managed one are never deleted, see policy.EvaluateSettings. It returns true if it started the
+// deletion of the App CR of the cluster, even if deleting the remaining resources failed. The App CR is kept until its
+// finalizers are done, so later reconciliations only retry deleting the remaining resources.
+func deleteClusterApp(ctx context.Context, log logr.Logger, client ctrlclient.Client, cluster *capi.Cluster, app *gsapplication.App) (bool, error) {
+	started := app.DeletionTimestamp == nil
+	if started {
+		log.Info("Cluster will be deleted")
+
+		// delete App CR for the cluster
+		log.Info(fmt.Sprintf("App %s/%s is being deleted", app.Name, app.Namespace))
+		if err := client.Delete(ctx, app, ctrlclient.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil {
+			log.Error(err, "unable to delete App CR for cluster")
+			ErrorsTotal.WithLabelValues(cluster.Name, cluster.Namespace).Inc()
+			return false, err
 		}
-		log.Error(err, "Unable to get app CR for cluster")
-		ErrorsTotal.WithLabelValues(cluster.Name, cluster.Namespace).Inc()
-		return nil
-	}
-	// ignore GitOps-managed resources, ensure we're not deleting cluster app CR of MC itself
-	if _, ok := app.Labels[fluxLabel]; ok {
-		IgnoredTotal.WithLabelValues(cluster.Name, cluster.Namespace).Inc()
-		log.Info(fmt.Sprintf("Found label %s in App CR. Cluster will be ignored for deletion", fluxLabel))
-		return nil
-	}
-
-	log.Info(fmt.Sprintf("Cluster has exceeded the default time to live (%s) and will be deleted", defaultTTL))
-
-	// delete App CR for the cluster
-	log.Info(fmt.Sprintf("App %s/%s is being deleted", app.Name, app.Namespace))
-	if err := client.Delete(ctx, app, ctrlclient.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil {
-		log.Error(err, "unable to delete App CR for cluster")
-		ErrorsTotal.WithLabelValues(cluster.Name, cluster.Namespace).Inc()
-		return err
+		log.Info(fmt.Sprintf("App %s/%s was deleted", app.Name, app.Namespace))
+	} else {
+		log.Info(fmt.Sprintf("App %s/%s is being deleted already", app.Name, app.Namespace))
 	}
-	log.Info(fmt.Sprintf("App %s/%s was deleted", app.Name, app.Namespace))
 
 	// delete default-apps App CR for the cluster
 	defaultApp := &gsapplication.App{}
 	if err := client.Get(ctx, getDefaultAppNamespacedName(cluster), defaultApp); err != nil {
 		if apierrors.IsNotFound(err) {
-			return nil
+			return started, nil
 		}
 		log.Error(err, "unable to get default-apps CR for cluster")
 		ErrorsTotal.WithLabelValues(cluster.Name, cluster.Namespace).Inc()
-		return err
+		return started, err
 	}
 	log.Info(fmt.Sprintf("App %s/%s is being deleted", defaultApp.Name, defaultApp.Namespace))
 
 	if err := client.Delete(ctx, defaultApp, ctrlclient.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil {
 		log.Error(err, "unable to delete default-apps App CR for cluster")
 		ErrorsTotal.WithLabelValues(cluster.Name, cluster.Namespace).Inc()
-		return err
+		return started, err
 	}
 	log.Info(fmt.Sprintf("App %s/%s was deleted", defaultApp.Name, defaultApp.Namespace))
 
@@ -232,28 +383,164 @@ func deleteClusterApp(ctx context.Context, log logr.Logger, client ctrlclient.Cl
 	}); err != nil {
 		log.Error(err, "unable to delete ConfigMaps for cluster")
 		ErrorsTotal.WithLabelValues(cluster.Name, cluster.Namespace).Inc()
-		return err
+		return started, err
 	}
 	log.Info("Cluster apps and configmaps were deleted")
 
-	SuccessTotal.WithLabelValues(cluster.Name, cluster.Namespace).Inc()
+	if started {
+		SuccessTotal.WithLabelValues(cluster.Name, cluster.Namespace).Inc()
+	}
 
-	return nil
+	return started, nil
+}
+
+// policyToClusters maps a cleanup policy to all clusters, as a changed selector may also affect clusters the policy
+// no longer selects.
+func (r *ClusterReconciler) policyToClusters(ctx context.Context, _ ctrlclient.Object) []reconcile.Request {
+	return r.clusterRequests(ctx)
+}
+
+// namespaceToClusters maps a namespace to the clusters in it, as its labels may select different cleanup policies.
+func (r *ClusterReconciler) namespaceToClusters(ctx context.Context, namespace ctrlclient.Object) []reconcile.Request {
+	return r.clusterRequests(ctx, ctrlclient.InNamespace(namespace.GetName()))
+}
+
+func (r *ClusterReconciler) clusterRequests(ctx context.Context, opts ...ctrlclient.ListOption) []reconcile.Request {
+	clusters := &capi.ClusterList{}
+	if err := r.List(ctx, clusters, opts...); err != nil {
+		r.Log.Error(err, "failed listing clusters")
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(clusters.Items))
+	for _, cluster := range clusters.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: ctrlclient.ObjectKeyFromObject(&cluster)})
+	}
+
+	return requests
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *ClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	err := ctrl.NewControllerManagedBy(mgr).
 		For(&capi.Cluster{}).
+		Watches(
+			&cleanerv1alpha1.CleanupPolicy{},
+			handler.EnqueueRequestsFromMapFunc(r.policyToClusters),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}),
+		).
+		Watches(
+			&corev1.Namespace{},
+			handler.EnqueueRequestsFromMapFunc(r.namespaceToClusters),
+			builder.WithPredicates(predicate.LabelChangedPredicate{}),
+		).
 		Complete(r)
 	if err != nil {
 		return errors.Wrap(err, "failed setting up with a controller manager")
 	}
 
-	r.recorder = mgr.GetEventRecorderFor("cluster-controller")
+	r.recorder = recordutil.NewDeduplicatingRecorder(mgr.GetEventRecorderFor("cluster-controller"), r.EventDeduplicationWindow, r.Clock)
+	recordutil.InitFromRecorder(r.recorder)
+
+	return nil
+}
+
+// checkIgnoredTooLong reports clusters which have been ignored for deletion for longer than the ignore warning threshold.
+func (r *ClusterReconciler) checkIgnoredTooLong(ctx context.Context, cluster *capi.Cluster, now time.Time) {
+	age := now.Sub(policy.CreationTime(cluster))
+	if r.IgnoreWarningThreshold <= 0 || age < r.IgnoreWarningThreshold {
+		IgnoredTooLong.DeleteLabelValues(cluster.Name, cluster.Namespace)
+		return
+	}
+
+	IgnoredTooLong.WithLabelValues(cluster.Name, cluster.Namespace).Set(1)
+	if !r.DryRun {
+		r.event(ctx, cluster, corev1.EventTypeWarning, messageIgnoredTooLong, time.Time{}, now, messageFields{IgnoredFor: age.Round(time.Hour)})
+	}
+}
+
+// ignoredRequeue requeues an ignored cluster at the next instant, e.g. when its ignore annotation expires, or when it
+// crosses the ignore warning threshold.
+func (r *ClusterReconciler) ignoredRequeue(cluster *capi.Cluster, next, now time.Time) ctrl.Result {
+	if r.IgnoreWarningThreshold > 0 {
+		warning := policy.CreationTime(cluster).Add(r.IgnoreWarningThreshold)
+		if warning.After(now) && (next.IsZero() || warning.Before(next)) {
+			next = warning
+		}
+	}
+	if next.IsZero() {
+		return ctrl.Result{}
+	}
+
+	return ctrl.Result{RequeueAfter: next.Sub(now)}
+}
+
+func (r *ClusterReconciler) maxKeepUntilBasis() policy.KeepUntilBasis {
+	if r.MaxKeepUntilBasis == "" {
+		return policy.KeepUntilBasisNow
+	}
+
+	return r.MaxKeepUntilBasis
+}
+
+// updateKeepUntilObservedAnnotation records when a keep-until value was observed first. It is only needed if the
+// maximum keep-until horizon is counted from when the value was set. The annotation is kept when the value changes or
+// is removed, so the horizon can not be restarted.
+func (r *ClusterReconciler) updateKeepUntilObservedAnnotation(ctx context.Context, cluster *capi.Cluster, now time.Time) error {
+	needed := r.MaxKeepUntilHorizon > 0 && r.maxKeepUntilBasis() == policy.KeepUntilBasisNow
+	_, found := cluster.Annotations[keepUntilObservedAnnotation]
+	if !needed && !found {
+		return nil
+	}
+
+	patch := ctrlclient.MergeFrom(cluster.DeepCopy())
+	if needed {
+		if _, ok := policy.KeepUntilObservedAt(cluster); ok {
+			return nil
+		}
+		keepUntilTime, keepUntilSource, err := policy.KeepUntil(cluster)
+		if err != nil || keepUntilSource == "" {
+			return nil
+		}
+		if cluster.Annotations == nil {
+			cluster.Annotations = map[string]string{}
+		}
+		cluster.Annotations[keepUntilObservedAnnotation] = fmt.Sprintf("%s/%s",
+			now.Format(time.RFC3339), keepUntilTime.UTC().Format(time.RFC3339))
+	} else {
+		delete(cluster.Annotations, keepUntilObservedAnnotation)
+	}
+	if err := r.Patch(ctx, cluster, patch); err != nil {
+		return errors.Wrapf(err, "failed updating %s annotation", keepUntilObservedAnnotation)
+	}
+
+	return nil
+}
+
+// updateDeleteAfterAnnotation sets the delete-after annotation to the deadline, or removes it if the cluster is not going to be deleted.
+func (r *ClusterReconciler) updateDeleteAfterAnnotation(ctx context.Context, cluster *capi.Cluster, deadline time.Time, ok bool) error {
+	value := deadline.UTC().Format(time.RFC3339)
+	current, found := cluster.Annotations[deleteAfterAnnotation]
+	if (ok && found && current == value) || (!ok && !found) {
+		return nil
+	}
+
+	patch := ctrlclient.MergeFrom(cluster.DeepCopy())
+	if ok {
+		if cluster.Annotations == nil {
+			cluster.Annotations = map[string]string{}
+		}
+		cluster.Annotations[deleteAfterAnnotation] = value
+	} else {
+		delete(cluster.Annotations, deleteAfterAnnotation)
+	}
+	if err := r.Patch(ctx, cluster, patch); err != nil {
+		return errors.Wrapf(err, "failed updating %s annotation", deleteAfterAnnotation)
+	}
+
 	return nil
 }
 
-func (r *ClusterReconciler) submitClusterDeletionEvent(cluster *capi.Cluster, message string) {
-	r.recorder.Eventf(cluster, corev1.EventTypeNormal, "ClusterMarkedForDeletion", "%s", message)
+func (r *ClusterReconciler) submitInvalidKeepUntilEvent(ctx context.Context, cluster *capi.Cluster, err error, now time.Time) {
+	r.event(ctx, cluster, corev1.EventTypeWarning, messageInvalidKeepUntil, time.Time{}, now, messageFields{Error: err.Error()})
 }
@@ -9,16 +9,23 @@ import (
 
 	gsapplication "github.com/giantswarm/apiextensions-application/api/v1alpha1"
 	"github.com/giantswarm/k8smetadata/pkg/label"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/tools/record"
+	testingclock "k8s.io/utils/clock/testing"
 	capi "sigs.k8s.io/cluster-api/api/core/v1beta2"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	cleanerv1alpha1 "github.com/giantswarm/cluster-cleaner/api/v1alpha1"
+	"github.com/giantswarm/cluster-cleaner/pkg/policy"
 )
 
 var (
@@ -29,9 +36,12 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(fakeScheme))
 	_ = capi.AddToScheme(fakeScheme)
 	_ = gsapplication.AddToScheme(fakeScheme)
+	_ = cleanerv1alpha1.AddToScheme(fakeScheme)
 }
 
 func TestClusterController(t *testing.T) {
+	now := time.Date(2022, 2, 1, 12, 0, 0, 0, time.UTC)
+
 	testCases := []struct {
 		name                   string
 		dryRun                 bool
@@ -51,7 +61,7 @@ func TestClusterController(t *testing.T) {
 					Name:      "test",
 					Namespace: "default",
 					CreationTimestamp: metav1.Time{
-						Time: time.Now().Add(-defaultTTL),
+						Time: now.Add(-defaultTTL),
 					},
 					Labels: map[string]string{
 						"cluster-operator.giantswarm.io/version": "5.1.1",
@@ -74,7 +84,7 @@ func TestClusterController(t *testing.T) {
 					Name:      "test",
 					Namespace: "default",
 					CreationTimestamp: metav1.Time{
-						Time: time.Now().Add(-5 * time.Hour),
+						Time: now.Add(-5 * time.Hour),
 					},
 					Annotations: map[string]string{},
 					Finalizers: []string{
@@ -94,7 +104,7 @@ func TestClusterController(t *testing.T) {
 					Name:      "test",
 					Namespace: "default",
 					CreationTimestamp: metav1.Time{
-						Time: time.Now().Add(-eventDefaultTTL),
+						Time: now.Add(-eventDefaultTTL),
 					},
 					Annotations: map[string]string{},
 					Finalizers: []string{
@@ -114,7 +124,7 @@ func TestClusterController(t *testing.T) {
 					Name:      "test",
 					Namespace: "default",
 					CreationTimestamp: metav1.Time{
-						Time: time.Now().Add(-eventDefaultTTL),
+						Time: now.Add(-eventDefaultTTL),
 					},
 					Annotations: map[string]string{
 						ignoreClusterDeletion: "true",
@@ -137,7 +147,7 @@ func TestClusterController(t *testing.T) {
 					Name:      "test",
 					Namespace: "default",
 					CreationTimestamp: metav1.Time{
-						Time: time.Now().Add(-defaultTTL),
+						Time: now.Add(-defaultTTL),
 					},
 					Annotations: map[string]string{},
 					Finalizers: []string{
@@ -159,7 +169,7 @@ func TestClusterController(t *testing.T) {
 					Name:      "test",
 					Namespace: "default",
 					CreationTimestamp: metav1.Time{
-						Time: time.Now().Add(-24 * time.Hour),
+						Time: now.Add(-24 * time.Hour),
 					},
 					Annotations: map[string]string{},
 					Labels: map[string]string{
@@ -183,11 +193,35 @@ func TestClusterController(t *testing.T) {
 					Name:      "test",
 					Namespace: "default",
 					CreationTimestamp: metav1.Time{
-						Time: time.Now().Add(-12 * time.Hour),
+						Time: now.Add(-12 * time.Hour),
 					},
 					Annotations: map[string]string{},
 					Labels: map[string]string{
-						keepUntil: time.Now().UTC().Format(keepUntilTimeLayout),
+						keepUntil: now.UTC().Format(keepUntilTimeLayout),
+					},
+					Finalizers: []string{
+						"operatorkit.giantswarm.io/cluster-operator-cluster-controller",
+					},
+				},
+			},
+		},
+		// keep-until annotation is set to a few hours from now - cluster should be kept, the warning lead time is not
+		// reached yet
+		{
+			name:                   "case 5c - keep-until annotation in a few hours",
+			dryRun:                 false,
+			expectedDeletion:       false,
+			expectedEventTriggered: false,
+
+			cluster: &capi.Cluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "default",
+					CreationTimestamp: metav1.Time{
+						Time: now.Add(-12 * time.Hour),
+					},
+					Annotations: map[string]string{
+						keepUntilAnnotation: now.Add(3 * time.Hour).UTC().Format(time.RFC3339),
 					},
 					Finalizers: []string{
 						"operatorkit.giantswarm.io/cluster-operator-cluster-controller",
@@ -207,7 +241,7 @@ func TestClusterController(t *testing.T) {
 					Name:      "test",
 					Namespace: "default",
 					CreationTimestamp: metav1.Time{
-						Time: time.Now().Add(-12 * time.Hour),
+						Time: now.Add(-12 * time.Hour),
 					},
 					Annotations: map[string]string{},
 					Labels: map[string]string{
@@ -232,7 +266,7 @@ func TestClusterController(t *testing.T) {
 					Name:      "test",
 					Namespace: "default",
 					CreationTimestamp: metav1.Time{
-						Time: time.Now().Add(-defaultTTL),
+						Time: now.Add(-defaultTTL),
 					},
 					Annotations: map[string]string{
 						"kustomize.toolkit.fluxcd.io/name": "flux",
@@ -258,7 +292,7 @@ func TestClusterController(t *testing.T) {
 					Name:      "test",
 					Namespace: "default",
 					CreationTimestamp: metav1.Time{
-						Time: time.Now().Add(-defaultTTL),
+						Time: now.Add(-defaultTTL),
 					},
 					Annotations: map[string]string{
 						"kustomize.toolkit.fluxcd.io/name": "flux",
@@ -270,6 +304,109 @@ func TestClusterController(t *testing.T) {
 				},
 			},
 		},
+		// cluster TTL annotation extends the default TTL
+		{
+			name:                   "case 9 - ttl annotation",
+			dryRun:                 false,
+			expectedDeletion:       false,
+			expectedEventTriggered: false,
+
+			cluster: &capi.Cluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "default",
+					CreationTimestamp: metav1.Time{
+						Time: now.Add(-defaultTTL),
+					},
+					Annotations: map[string]string{
+						clusterTTL: "10h",
+					},
+					Labels: map[string]string{
+						"cluster-operator.giantswarm.io/version": "5.1.1",
+					},
+					Finalizers: []string{
+						"operatorkit.giantswarm.io/cluster-operator-cluster-controller",
+					},
+				},
+			},
+		},
+		// cluster TTL label shortens the default TTL
+		{
+			name:                   "case 10 - ttl label",
+			dryRun:                 false,
+			expectedDeletion:       true,
+			expectedEventTriggered: false,
+
+			cluster: &capi.Cluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "default",
+					CreationTimestamp: metav1.Time{
+						Time: now.Add(-2 * time.Hour),
+					},
+					Annotations: map[string]string{},
+					Labels: map[string]string{
+						clusterTTL:                               "90m",
+						"cluster-operator.giantswarm.io/version": "5.1.1",
+					},
+					Finalizers: []string{
+						"operatorkit.giantswarm.io/cluster-operator-cluster-controller",
+					},
+				},
+			},
+		},
+		// cluster TTL is taken into account for the marked for deletion event
+		{
+			name:                   "case 11 - ttl event",
+			dryRun:                 false,
+			expectedDeletion:       false,
+			expectedEventTriggered: true,
+
+			cluster: &capi.Cluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "default",
+					CreationTimestamp: metav1.Time{
+						Time: now.Add(-9*time.Hour - 30*time.Minute),
+					},
+					Annotations: map[string]string{
+						clusterTTL: "10h",
+					},
+					Labels: map[string]string{
+						"cluster-operator.giantswarm.io/version": "5.1.1",
+					},
+					Finalizers: []string{
+						"operatorkit.giantswarm.io/cluster-operator-cluster-controller",
+					},
+				},
+			},
+		},
+		// cluster TTL longer than the max age skips the max age check
+		{
+			name:                   "case 12 - ttl beyond max age",
+			dryRun:                 false,
+			expectedDeletion:       true,
+			expectedEventTriggered: false,
+
+			cluster: &capi.Cluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "default",
+					CreationTimestamp: metav1.Time{
+						Time: now.Add(-9 * 24 * time.Hour),
+					},
+					Annotations: map[string]string{
+						clusterTTL: "192h",
+					},
+					Labels: map[string]string{
+						"cluster-operator.giantswarm.io/version": "5.1.1",
+					},
+					Finalizers: []string{
+						"operatorkit.giantswarm.io/cluster-operator-cluster-controller",
+					},
+				},
+			},
+		},
 	}
 	for i, tc := range testCases {
 		t.Run(strconv.Itoa(i), func(t *testing.T) {
@@ -281,6 +418,7 @@ func TestClusterController(t *testing.T) {
 				Log:      ctrl.Log.WithName("fake"),
 				recorder: fakeRecorder,
 				DryRun:   tc.dryRun,
+				Clock:    testingclock.NewFakePassiveClock(now),
 			}
 			ctx := context.TODO()
 			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: tc.cluster.GetName(), Namespace: tc.cluster.GetNamespace()}})
@@ -318,6 +456,8 @@ func TestClusterController(t *testing.T) {
 }
 
 func TestClusterAppDeletion(t *testing.T) {
+	now := time.Date(2022, 2, 1, 12, 0, 0, 0, time.UTC)
+
 	testCases := []struct {
 		name                    string
 		dryRun                  bool
@@ -339,7 +479,7 @@ func TestClusterAppDeletion(t *testing.T) {
 					Name:      "test",
 					Namespace: "default",
 					CreationTimestamp: metav1.Time{
-						Time: time.Now().Add(-defaultTTL),
+						Time: now.Add(-defaultTTL),
 					},
 					Annotations: map[string]string{
 						helmReleaseNameAnnotation:      "test",
@@ -381,7 +521,7 @@ func TestClusterAppDeletion(t *testing.T) {
 					Name:      "test",
 					Namespace: "default",
 					CreationTimestamp: metav1.Time{
-						Time: time.Now().Add(defaultTTL),
+						Time: now.Add(defaultTTL),
 					},
 					Annotations: map[string]string{
 						helmReleaseNameAnnotation:      "test",
@@ -423,7 +563,7 @@ func TestClusterAppDeletion(t *testing.T) {
 					Name:      "test",
 					Namespace: "default",
 					CreationTimestamp: metav1.Time{
-						Time: time.Now().Add(-defaultTTL),
+						Time: now.Add(-defaultTTL),
 					},
 					Labels: map[string]string{
 						"cluster-operator.giantswarm.io/version": "5.1.1",
@@ -452,7 +592,7 @@ func TestClusterAppDeletion(t *testing.T) {
 					Name:      "test",
 					Namespace: "default",
 					CreationTimestamp: metav1.Time{
-						Time: time.Now().Add(-defaultTTL),
+						Time: now.Add(-defaultTTL),
 					},
 					Annotations: map[string]string{
 						helmReleaseNameAnnotation:      "test",
@@ -546,6 +686,7 @@ func TestClusterAppDeletion(t *testing.T) {
 				Log:      ctrl.Log.WithName("fake"),
 				recorder: fakeRecorder,
 				DryRun:   tc.dryRun,
+				Clock:    testingclock.NewFakePassiveClock(now),
 			}
 			ctx := context.TODO()
 			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: tc.cluster.GetName(), Namespace: tc.cluster.GetNamespace()}})
@@ -584,3 +725,552 @@ func TestClusterAppDeletion(t *testing.T) {
 		})
 	}
 }
+
+func TestInvalidKeepUntil(t *testing.T) {
+	now := time.Date(2022, 2, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name              string
+		behaviour         policy.InvalidKeepUntilBehaviour
+		expectedDeletion  bool
+		expectedRequeue   time.Duration
+		creationTimestamp time.Time
+	}{
+		{
+			name:              "case 0 - ignore",
+			behaviour:         policy.InvalidKeepUntilIgnore,
+			expectedDeletion:  false,
+			expectedRequeue:   invalidKeepUntilRequeue,
+			creationTimestamp: now.Add(-defaultTTL),
+		},
+		{
+			name:              "case 1 - default is ignore",
+			expectedDeletion:  false,
+			expectedRequeue:   invalidKeepUntilRequeue,
+			creationTimestamp: now.Add(-defaultTTL),
+		},
+		{
+			name:              "case 2 - absent",
+			behaviour:         policy.InvalidKeepUntilAbsent,
+			expectedDeletion:  true,
+			creationTimestamp: now.Add(-defaultTTL),
+		},
+		{
+			name:              "case 3 - absent older than max age",
+			behaviour:         policy.InvalidKeepUntilAbsent,
+			expectedDeletion:  false,
+			creationTimestamp: now.Add(-8 * 24 * time.Hour),
+		},
+		{
+			name:              "case 4 - delete older than max age",
+			behaviour:         policy.InvalidKeepUntilDelete,
+			expectedDeletion:  true,
+			creationTimestamp: now.Add(-8 * 24 * time.Hour),
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			cluster := &capi.Cluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "invalid",
+					Namespace: "default",
+					CreationTimestamp: metav1.Time{
+						Time: tc.creationTimestamp,
+					},
+					Annotations: map[string]string{},
+					Labels: map[string]string{
+						keepUntil:                                "next-friday",
+						"cluster-operator.giantswarm.io/version": "5.1.1",
+					},
+					Finalizers: []string{
+						"operatorkit.giantswarm.io/cluster-operator-cluster-controller",
+					},
+				},
+			}
+			fakeClient := fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(cluster).Build()
+			fakeRecorder := record.NewFakeRecorder(1)
+			r := &ClusterReconciler{
+				Client:   fakeClient,
+				Scheme:   fakeScheme,
+				Log:      ctrl.Log.WithName("fake"),
+				recorder: fakeRecorder,
+
+				Options: Options{
+					Config: policy.Config{InvalidKeepUntilBehaviour: tc.behaviour},
+				},
+				Clock: testingclock.NewFakePassiveClock(now),
+			}
+			ctx := context.TODO()
+			key := types.NamespacedName{Name: cluster.GetName(), Namespace: cluster.GetNamespace()}
+			result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			if err != nil {
+				t.Error(err)
+			}
+			assert.Equal(t, tc.expectedRequeue, result.RequeueAfter, "test case %v failed.", tc.name)
+
+			obj := &capi.Cluster{}
+			err = fakeClient.Get(ctx, key, obj)
+			if err != nil {
+				t.Error(err)
+			}
+			assert.Equal(t, tc.expectedDeletion, obj.DeletionTimestamp != nil, "test case %v failed.", tc.name)
+
+			select {
+			case event := <-fakeRecorder.Events:
+				assert.Contains(t, event, "Warning InvalidKeepUntil", "test case %v failed.", tc.name)
+			default:
+				t.Errorf("test case %v failed. expected InvalidKeepUntil event", tc.name)
+			}
+			assert.Equal(t, float64(1), gaugeValue(t, InvalidKeepUntil, cluster.Name, cluster.Namespace), "test case %v failed.", tc.name)
+		})
+	}
+}
+
+func gaugeValue(t *testing.T, gauge *prometheus.GaugeVec, labelValues ...string) float64 {
+	m := &dto.Metric{}
+	if err := gauge.WithLabelValues(labelValues...).Write(m); err != nil {
+		t.Fatal(err)
+	}
+
+	return m.GetGauge().GetValue()
+}
+
+func TestDeleteAfterAnnotation(t *testing.T) {
+	now := time.Date(2022, 2, 1, 12, 0, 0, 0, time.UTC)
+	created := now.Add(-1 * time.Hour)
+
+	testCases := []struct {
+		name          string
+		age           time.Duration
+		annotations   map[string]string
+		expectedValue string
+		expectedFound bool
+	}{
+		{
+			name:          "case 0 - annotation is added",
+			annotations:   map[string]string{},
+			expectedValue: created.Add(defaultTTL).UTC().Format(time.RFC3339),
+			expectedFound: true,
+		},
+		{
+			name: "case 1 - annotation is updated after ttl change",
+			annotations: map[string]string{
+				clusterTTL:            "10h",
+				deleteAfterAnnotation: created.Add(defaultTTL).UTC().Format(time.RFC3339),
+			},
+			expectedValue: created.Add(10 * time.Hour).UTC().Format(time.RFC3339),
+			expectedFound: true,
+		},
+		{
+			name: "case 2 - annotation is updated after keep-until change",
+			annotations: map[string]string{
+				keepUntilAnnotation:   "2099-12-01T18:00:00Z",
+				deleteAfterAnnotation: created.Add(defaultTTL).UTC().Format(time.RFC3339),
+			},
+			expectedValue: "2099-12-01T18:00:00Z",
+			expectedFound: true,
+		},
+		{
+			name: "case 3 - annotation is removed from ignored cluster",
+			annotations: map[string]string{
+				ignoreClusterDeletion: "true",
+				deleteAfterAnnotation: created.Add(defaultTTL).UTC().Format(time.RFC3339),
+			},
+			expectedFound: false,
+		},
+		{
+			name: "case 4 - annotation is removed from cluster older than the max age",
+			age:  defaultMaxAge + time.Hour,
+			annotations: map[string]string{
+				deleteAfterAnnotation: created.Add(defaultTTL).UTC().Format(time.RFC3339),
+			},
+			expectedFound: false,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			cluster := &capi.Cluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "default",
+					CreationTimestamp: metav1.Time{
+						Time: created.Add(-tc.age),
+					},
+					Annotations: tc.annotations,
+				},
+			}
+			fakeClient := fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(cluster).Build()
+			r := &ClusterReconciler{
+				Client:   fakeClient,
+				Scheme:   fakeScheme,
+				Log:      ctrl.Log.WithName("fake"),
+				recorder: record.NewFakeRecorder(1),
+				Clock:    testingclock.NewFakePassiveClock(now),
+			}
+			ctx := context.TODO()
+			key := types.NamespacedName{Name: cluster.GetName(), Namespace: cluster.GetNamespace()}
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			if err != nil {
+				t.Error(err)
+			}
+
+			obj := &capi.Cluster{}
+			err = fakeClient.Get(ctx, key, obj)
+			if err != nil {
+				t.Error(err)
+			}
+			v, found := obj.Annotations[deleteAfterAnnotation]
+			assert.Equal(t, tc.expectedFound, found, "test case %v failed.", tc.name)
+			assert.Equal(t, tc.expectedValue, v, "test case %v failed.", tc.name)
+		})
+	}
+}
+
+func TestIgnoreAnnotationExpiry(t *testing.T) {
+	now := time.Date(2022, 2, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name             string
+		ignore           string
+		options          Options
+		expectedDeletion bool
+		expectedRequeue  time.Duration
+		expectedWarning  bool
+	}{
+		{
+			name:             "case 0 - no expiry",
+			ignore:           "true",
+			expectedDeletion: false,
+		},
+		{
+			name:             "case 1 - expired duration",
+			ignore:           "2h",
+			expectedDeletion: true,
+		},
+		{
+			name:             "case 2 - duration",
+			ignore:           "48h",
+			expectedDeletion: false,
+			// the warning lead time before the expiry
+			expectedRequeue: 43 * time.Hour,
+		},
+		{
+			name:             "case 3 - expired date",
+			ignore:           "2020-12-08",
+			expectedDeletion: true,
+		},
+		{
+			name:             "case 4 - max ignore period",
+			ignore:           "true",
+			options:          Options{Config: policy.Config{MaxIgnorePeriod: 2 * time.Hour}},
+			expectedDeletion: true,
+		},
+		{
+			name:             "case 5 - max ignore period limits expiry",
+			ignore:           "48h",
+			options:          Options{Config: policy.Config{MaxIgnorePeriod: 6 * time.Hour}},
+			expectedDeletion: false,
+			expectedRequeue:  1 * time.Hour,
+		},
+		{
+			name:             "case 6 - ignored too long",
+			ignore:           "true",
+			options:          Options{IgnoreWarningThreshold: 1 * time.Hour},
+			expectedDeletion: false,
+			expectedWarning:  true,
+		},
+		{
+			name:             "case 7 - requeue at ignore warning threshold",
+			ignore:           "true",
+			options:          Options{IgnoreWarningThreshold: 5 * time.Hour},
+			expectedDeletion: false,
+			expectedRequeue:  1 * time.Hour,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			cluster := &capi.Cluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "ignored",
+					Namespace: "default",
+					CreationTimestamp: metav1.Time{
+						Time: now.Add(-defaultTTL),
+					},
+					Annotations: map[string]string{
+						ignoreClusterDeletion: tc.ignore,
+					},
+					Labels: map[string]string{
+						"cluster-operator.giantswarm.io/version": "5.1.1",
+					},
+					Finalizers: []string{
+						"operatorkit.giantswarm.io/cluster-operator-cluster-controller",
+					},
+				},
+			}
+			fakeClient := fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(cluster).Build()
+			fakeRecorder := record.NewFakeRecorder(1)
+			r := &ClusterReconciler{
+				Client:   fakeClient,
+				Scheme:   fakeScheme,
+				Log:      ctrl.Log.WithName("fake"),
+				recorder: fakeRecorder,
+				Options:  tc.options,
+				Clock:    testingclock.NewFakePassiveClock(now),
+			}
+			ctx := context.TODO()
+			key := types.NamespacedName{Name: cluster.GetName(), Namespace: cluster.GetNamespace()}
+			result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			if err != nil {
+				t.Error(err)
+			}
+			assert.Equal(t, tc.expectedRequeue, result.RequeueAfter, "test case %v failed.", tc.name)
+
+			obj := &capi.Cluster{}
+			err = fakeClient.Get(ctx, key, obj)
+			if err != nil {
+				t.Error(err)
+			}
+			assert.Equal(t, tc.expectedDeletion, obj.DeletionTimestamp != nil, "test case %v failed.", tc.name)
+
+			warning := false
+			select {
+			case event := <-fakeRecorder.Events:
+				warning = strings.Contains(event, "Warning ClusterIgnoredTooLong")
+			default:
+			}
+			assert.Equal(t, tc.expectedWarning, warning, "test case %v failed.", tc.name)
+			if tc.expectedWarning {
+				assert.Equal(t, float64(1), gaugeValue(t, IgnoredTooLong, cluster.Name, cluster.Namespace), "test case %v failed.", tc.name)
+			}
+		})
+	}
+}
+
+func TestKeepUntilHorizon(t *testing.T) {
+	now := time.Date(2022, 2, 1, 12, 0, 0, 0, time.UTC)
+	created := now.Add(-30 * time.Hour)
+
+	testCases := []struct {
+		name                string
+		options             Options
+		annotations         map[string]string
+		expectedDeletion    bool
+		expectedDeleteAfter time.Time
+	}{
+		{
+			name:             "case 0 - clamped from creation and expired",
+			options:          Options{Config: policy.Config{MaxKeepUntilHorizon: 24 * time.Hour, MaxKeepUntilBasis: policy.KeepUntilBasisCreation}},
+			annotations:      map[string]string{},
+			expectedDeletion: true,
+		},
+		{
+			name:                "case 1 - clamped from creation",
+			options:             Options{Config: policy.Config{MaxKeepUntilHorizon: 48 * time.Hour, MaxKeepUntilBasis: policy.KeepUntilBasisCreation}},
+			annotations:         map[string]string{},
+			expectedDeletion:    false,
+			expectedDeleteAfter: created.Add(48 * time.Hour),
+		},
+		{
+			name:                "case 2 - clamped from now",
+			options:             Options{Config: policy.Config{MaxKeepUntilHorizon: 24 * time.Hour}},
+			annotations:         map[string]string{},
+			expectedDeletion:    false,
+			expectedDeleteAfter: now.Add(24 * time.Hour),
+		},
+		{
+			name:    "case 3 - clamped from observation and expired",
+			options: Options{Config: policy.Config{MaxKeepUntilHorizon: 24 * time.Hour}},
+			annotations: map[string]string{
+				keepUntilObservedAnnotation: created.Format(time.RFC3339) + "/2099-12-02T00:00:00Z",
+			},
+			expectedDeletion: true,
+		},
+		{
+			name:                "case 4 - no horizon",
+			annotations:         map[string]string{},
+			expectedDeletion:    false,
+			expectedDeleteAfter: time.Date(2099, 12, 2, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "case 5 - new value does not restart the horizon",
+			options: Options{Config: policy.Config{MaxKeepUntilHorizon: 24 * time.Hour}},
+			annotations: map[string]string{
+				keepUntilObservedAnnotation: created.Format(time.RFC3339) + "/2099-01-01T00:00:00Z",
+			},
+			expectedDeletion: true,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			observed, hasObserved := tc.annotations[keepUntilObservedAnnotation]
+			cluster := &capi.Cluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "clamped",
+					Namespace: "default",
+					CreationTimestamp: metav1.Time{
+						Time: created,
+					},
+					Annotations: tc.annotations,
+					Labels: map[string]string{
+						keepUntil:                                "2099-12-01",
+						"cluster-operator.giantswarm.io/version": "5.1.1",
+					},
+					Finalizers: []string{
+						"operatorkit.giantswarm.io/cluster-operator-cluster-controller",
+					},
+				},
+			}
+			fakeClient := fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(cluster).Build()
+			fakeRecorder := record.NewFakeRecorder(1)
+			r := &ClusterReconciler{
+				Client:   fakeClient,
+				Scheme:   fakeScheme,
+				Log:      ctrl.Log.WithName("fake"),
+				recorder: fakeRecorder,
+				Options:  tc.options,
+				Clock:    testingclock.NewFakePassiveClock(now),
+			}
+			ctx := context.TODO()
+			key := types.NamespacedName{Name: cluster.GetName(), Namespace: cluster.GetNamespace()}
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			if err != nil {
+				t.Error(err)
+			}
+
+			obj := &capi.Cluster{}
+			err = fakeClient.Get(ctx, key, obj)
+			if err != nil {
+				t.Error(err)
+			}
+			assert.Equal(t, tc.expectedDeletion, obj.DeletionTimestamp != nil, "test case %v failed.", tc.name)
+
+			clamped := false
+			select {
+			case event := <-fakeRecorder.Events:
+				clamped = strings.Contains(event, "Warning KeepUntilClamped")
+			default:
+			}
+			assert.Equal(t, tc.options.MaxKeepUntilHorizon > 0, clamped, "test case %v failed.", tc.name)
+			if hasObserved {
+				assert.Equal(t, observed, obj.Annotations[keepUntilObservedAnnotation], "test case %v failed.", tc.name)
+			}
+
+			if !tc.expectedDeletion {
+				deleteAfter, err := time.Parse(time.RFC3339, obj.Annotations[deleteAfterAnnotation])
+				if err != nil {
+					t.Fatal(err)
+				}
+				assert.True(t, tc.expectedDeleteAfter.Equal(deleteAfter), "test case %v failed. expected %v, got %v", tc.name, tc.expectedDeleteAfter, deleteAfter)
+			}
+		})
+	}
+}
+
+func TestDeleteNowAnnotation(t *testing.T) {
+	now := time.Date(2022, 2, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name             string
+		labels           map[string]string
+		annotations      map[string]string
+		appLabels        map[string]string
+		expectedDeletion bool
+		// expectedRequester is named in the event of the deletion
+		expectedRequester string
+	}{
+		{
+			name:              "case 0 - delete now",
+			annotations:       map[string]string{deleteNowAnnotation: "true"},
+			expectedDeletion:  true,
+			expectedRequester: "unknown",
+		},
+		{
+			name: "case 1 - delete now overrides keep-until",
+			annotations: map[string]string{
+				deleteNowAnnotation: "true",
+				keepUntilAnnotation: "2099-12-01T00:00:00Z",
+			},
+			expectedDeletion: true,
+		},
+		{
+			name:             "case 2 - delete now disabled",
+			annotations:      map[string]string{deleteNowAnnotation: "false"},
+			expectedDeletion: false,
+		},
+		{
+			name:             "case 3 - flux cluster",
+			labels:           map[string]string{fluxLabel: "flux"},
+			annotations:      map[string]string{deleteNowAnnotation: "true"},
+			expectedDeletion: false,
+		},
+		{
+			name:             "case 4 - flux app",
+			annotations:      map[string]string{deleteNowAnnotation: "true"},
+			appLabels:        map[string]string{fluxLabel: "flux"},
+			expectedDeletion: false,
+		},
+		{
+			name: "case 5 - ignored cluster",
+			annotations: map[string]string{
+				deleteNowAnnotation:   "true",
+				ignoreClusterDeletion: "true",
+			},
+			expectedDeletion: false,
+		},
+		{
+			name: "case 6 - requester recorded by the webhook",
+			annotations: map[string]string{
+				deleteNowAnnotation:         "true",
+				deleteRequestedByAnnotation: "alice@example.com",
+			},
+			expectedDeletion:  true,
+			expectedRequester: "alice@example.com",
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			tc.annotations[helmReleaseNameAnnotation] = "test"
+			tc.annotations[helmReleaseNamespaceAnnotation] = "default"
+			cluster := &capi.Cluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "default",
+					CreationTimestamp: metav1.Time{
+						Time: now.Add(-10 * time.Minute),
+					},
+					Labels:      tc.labels,
+					Annotations: tc.annotations,
+				},
+			}
+			app := &gsapplication.App{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "default",
+					Labels:    tc.appLabels,
+				},
+			}
+			fakeClient := fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(cluster, app).Build()
+			fakeRecorder := record.NewFakeRecorder(10)
+			r := &ClusterReconciler{
+				Client:   fakeClient,
+				Scheme:   fakeScheme,
+				Log:      ctrl.Log.WithName("fake"),
+				recorder: fakeRecorder,
+				Clock:    testingclock.NewFakePassiveClock(now),
+			}
+			ctx := context.TODO()
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: cluster.Name, Namespace: cluster.Namespace}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = fakeClient.Get(ctx, types.NamespacedName{Name: app.Name, Namespace: app.Namespace}, &gsapplication.App{})
+			assert.Equal(t, tc.expectedDeletion, apierrors.IsNotFound(err), "test case %v failed. unexpected error %v", tc.name, err)
+
+			if tc.expectedRequester != "" {
+				event := <-fakeRecorder.Events
+				assert.Equal(t, "Normal ClusterDeletionRequested Deletion of the cluster was requested by "+tc.expectedRequester+".", event, "test case %v failed.", tc.name)
+			}
+		})
+	}
+}
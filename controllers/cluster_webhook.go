@@ -0,0 +1,305 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	admissionv1 "k8s.io/api/admission/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/utils/clock"
+	capi "sigs.k8s.io/cluster-api/api/core/v1beta2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/giantswarm/cluster-cleaner/pkg/policy"
+)
+
+// ClusterValidator validates the cleanup labels and annotations of clusters, so mistakes are caught at admission
+// time instead of being logged by the controller. Only labels and annotations changed by a request are validated.
+type ClusterValidator struct {
+	Options
+
+	// IgnoreAllowedUsers and IgnoreAllowedGroups list who may set the ignore annotation.
+	// Everybody may set it if both are empty.
+	IgnoreAllowedUsers  []string
+	IgnoreAllowedGroups []string
+
+	// ControllerUsername is the user of the controller. Only it may change the bookkeeping annotations of the
+	// controller. They are not protected if it is empty.
+	ControllerUsername string
+
+	// Clock is the source of the current time. The real time is used if it is not set.
+	Clock clock.PassiveClock
+}
+
+// +kubebuilder:webhook:path=/validate-cluster-x-k8s-io-v1beta2-cluster,mutating=false,failurePolicy=ignore,sideEffects=None,groups=cluster.x-k8s.io,resources=clusters,verbs=create;update,versions=v1beta2,name=vcluster.cluster-cleaner.giantswarm.io,admissionReviewVersions=v1
+
+// SetupWebhookWithManager registers the validating webhook with the Manager.
+func (v *ClusterValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	err := ctrl.NewWebhookManagedBy(mgr, &capi.Cluster{}).
+		WithValidator(v).
+		Complete()
+	if err != nil {
+		return errors.Wrap(err, "failed setting up validating webhook with a controller manager")
+	}
+
+	return nil
+}
+
+// ValidateCreate validates the cleanup labels and annotations of a new cluster.
+func (v *ClusterValidator) ValidateCreate(ctx context.Context, cluster *capi.Cluster) (admission.Warnings, error) {
+	return nil, v.validate(ctx, nil, cluster)
+}
+
+// ValidateUpdate validates the cleanup labels and annotations changed on a cluster.
+func (v *ClusterValidator) ValidateUpdate(ctx context.Context, oldCluster, cluster *capi.Cluster) (admission.Warnings, error) {
+	return nil, v.validate(ctx, oldCluster, cluster)
+}
+
+// ValidateDelete allows all cluster deletions.
+func (v *ClusterValidator) ValidateDelete(_ context.Context, _ *capi.Cluster) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *ClusterValidator) validate(ctx context.Context, oldCluster, cluster *capi.Cluster) error {
+	var allErrs field.ErrorList
+	labelsPath := field.NewPath("metadata", "labels")
+	annotationsPath := field.NewPath("metadata", "annotations")
+
+	if labelChanged(oldCluster, cluster, keepUntil) {
+		path := labelsPath.Key(keepUntil)
+		t, ok, err := policy.KeepUntilFromLabel(cluster)
+		allErrs = append(allErrs, v.validateKeepUntil(cluster, path, cluster.Labels[keepUntil], t, ok, err)...)
+	}
+
+	if annotationChanged(oldCluster, cluster, keepUntilAnnotation) || annotationChanged(oldCluster, cluster, keepUntilTimezoneAnnotation) {
+		path := annotationsPath.Key(keepUntilAnnotation)
+		t, ok, err := policy.KeepUntilFromAnnotation(cluster)
+		allErrs = append(allErrs, v.validateKeepUntil(cluster, path, cluster.Annotations[keepUntilAnnotation], t, ok, err)...)
+	}
+
+	if labelChanged(oldCluster, cluster, clusterTTL) || annotationChanged(oldCluster, cluster, clusterTTL) {
+		if _, _, err := policy.TTL(cluster); err != nil {
+			path := labelsPath.Key(clusterTTL)
+			value := cluster.Labels[clusterTTL]
+			if annotation, ok := cluster.Annotations[clusterTTL]; ok {
+				path = annotationsPath.Key(clusterTTL)
+				value = annotation
+			}
+			allErrs = append(allErrs, field.Invalid(path, value, err.Error()))
+		}
+	}
+
+	if value, ok := cluster.Annotations[extendByAnnotation]; ok && annotationChanged(oldCluster, cluster, extendByAnnotation) {
+		if _, err := parseExtendBy(value); err != nil {
+			allErrs = append(allErrs, field.Invalid(annotationsPath.Key(extendByAnnotation), value, err.Error()))
+		}
+	}
+
+	if value, ok := cluster.Annotations[ignoreClusterDeletion]; ok && annotationChanged(oldCluster, cluster, ignoreClusterDeletion) {
+		if err := v.ignoreAllowed(ctx); err != nil {
+			allErrs = append(allErrs, field.Forbidden(annotationsPath.Key(ignoreClusterDeletion), err.Error()))
+		}
+		if _, expires := policy.ParseIgnoreExpiry(value, currentTime(v.Clock)); !expires && value != "true" && value != "" {
+			allErrs = append(allErrs, field.Invalid(annotationsPath.Key(ignoreClusterDeletion), value, "must be true, a duration, a date or a RFC3339 timestamp"))
+		}
+	}
+
+	for _, key := range bookkeepingAnnotations {
+		if annotationChanged(oldCluster, cluster, key) {
+			if err := v.bookkeepingAllowed(ctx, key, cluster.Annotations[key]); err != nil {
+				allErrs = append(allErrs, field.Forbidden(annotationsPath.Key(key), err.Error()))
+			}
+		}
+	}
+
+	if len(allErrs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(capi.GroupVersion.WithKind("Cluster").GroupKind(), cluster.Name, allErrs)
+}
+
+func (v *ClusterValidator) validateKeepUntil(cluster *capi.Cluster, path *field.Path, value string, t time.Time, ok bool, err error) field.ErrorList {
+	if err != nil {
+		return field.ErrorList{field.Invalid(path, value, err.Error())}
+	}
+	if !ok {
+		return nil
+	}
+
+	now := currentTime(v.Clock)
+	created := policy.CreationTime(cluster)
+	if cluster.CreationTimestamp.IsZero() {
+		created = now
+	}
+	if limit, ok := policy.MaxKeepUntil(cluster, created, v.Config, now); ok && t.After(limit) {
+		return field.ErrorList{field.Invalid(path, value, fmt.Sprintf("must not be after %s", limit.Format(time.RFC3339)))}
+	}
+
+	return nil
+}
+
+// ignoreAllowed returns an error if the user of the admission request may not set the ignore annotation.
+func (v *ClusterValidator) ignoreAllowed(ctx context.Context) error {
+	if len(v.IgnoreAllowedUsers) == 0 && len(v.IgnoreAllowedGroups) == 0 {
+		return nil
+	}
+
+	req, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	if slices.Contains(v.IgnoreAllowedUsers, req.UserInfo.Username) {
+		return nil
+	}
+	for _, group := range req.UserInfo.Groups {
+		if slices.Contains(v.IgnoreAllowedGroups, group) {
+			return nil
+		}
+	}
+
+	return errors.Errorf("user %q is not allowed to ignore the cluster for deletion", req.UserInfo.Username)
+}
+
+// bookkeepingAllowed returns an error if the user of the admission request may not change the bookkeeping annotation.
+// Besides the controller, users may only name themselves as requester of an extension or deletion, as the mutating
+// webhook does.
+func (v *ClusterValidator) bookkeepingAllowed(ctx context.Context, key, value string) error {
+	if v.ControllerUsername == "" {
+		return nil
+	}
+
+	req, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	if req.UserInfo.Username == v.ControllerUsername {
+		return nil
+	}
+	if (key == extendRequestedByAnnotation || key == deleteRequestedByAnnotation) && value == req.UserInfo.Username {
+		return nil
+	}
+
+	return errors.Errorf("user %q is not allowed to change an annotation managed by the cluster-cleaner", req.UserInfo.Username)
+}
+
+// ClusterDefaulter stamps the computed deletion deadline on new clusters, so users can see when their cluster will be removed.
+type ClusterDefaulter struct {
+	Client ctrlclient.Client
+
+	Options
+
+	// Clock is the source of the current time. The real time is used if it is not set.
+	Clock clock.PassiveClock
+}
+
+// +kubebuilder:webhook:path=/mutate-cluster-x-k8s-io-v1beta2-cluster,mutating=true,failurePolicy=ignore,sideEffects=None,groups=cluster.x-k8s.io,resources=clusters,verbs=create;update,versions=v1beta2,name=mcluster.cluster-cleaner.giantswarm.io,admissionReviewVersions=v1
+
+// SetupWebhookWithManager registers the mutating webhook with the Manager.
+func (d *ClusterDefaulter) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	err := ctrl.NewWebhookManagedBy(mgr, &capi.Cluster{}).
+		WithDefaulter(d).
+		Complete()
+	if err != nil {
+		return errors.Wrap(err, "failed setting up mutating webhook with a controller manager")
+	}
+
+	return nil
+}
+
+// Default records who requested an extension or the deletion of a cluster and sets the owner annotation and the
+// delete-after annotation on new clusters which are going to be deleted.
+func (d *ClusterDefaulter) Default(ctx context.Context, cluster *capi.Cluster) error {
+	log := logf.FromContext(ctx)
+
+	req, err := admission.RequestFromContext(ctx)
+	if err == nil {
+		recordRequester(req, cluster, extendByAnnotation, extendRequestedByAnnotation)
+		recordRequester(req, cluster, deleteNowAnnotation, deleteRequestedByAnnotation)
+		// the delete-after annotation of existing clusters is kept up to date by the reconciler
+		if req.Operation == admissionv1.Update {
+			return nil
+		}
+	}
+
+	// clusters created by controllers, e.g. helm for cluster apps, are attributed by the reconciler
+	if err == nil && cluster.Annotations[ownerAnnotation] == "" &&
+		cluster.Annotations[creatorAnnotation] == "" && !strings.HasPrefix(req.UserInfo.Username, "system:") {
+		if cluster.Annotations == nil {
+			cluster.Annotations = map[string]string{}
+		}
+		cluster.Annotations[ownerAnnotation] = req.UserInfo.Username
+	}
+
+	s, err := resolveSettings(ctx, d.Client, cluster)
+	if err != nil {
+		// never block cluster creation because of the cleaner, the reconciler sets the annotation later on
+		log.Error(err, "failed resolving cleanup settings for cluster")
+		return nil
+	}
+
+	deadline, ok := policy.Deadline(cluster, s, d.Config, currentTime(d.Clock))
+	if !ok {
+		return nil
+	}
+
+	if cluster.Annotations == nil {
+		cluster.Annotations = map[string]string{}
+	}
+	cluster.Annotations[deleteAfterAnnotation] = deadline.UTC().Format(time.RFC3339)
+
+	return nil
+}
+
+// recordRequester sets the requester annotation to the user of the request if it sets the annotation, e.g. extend-by,
+// so the request is attributed to the user instead of the field manager.
+func recordRequester(req admission.Request, cluster *capi.Cluster, key, requesterKey string) {
+	value, ok := cluster.Annotations[key]
+	if !ok {
+		return
+	}
+
+	oldCluster := &capi.Cluster{}
+	if err := json.Unmarshal(req.OldObject.Raw, oldCluster); err == nil {
+		if oldValue, oldOK := oldCluster.Annotations[key]; oldOK && oldValue == value {
+			return
+		}
+	}
+
+	cluster.Annotations[requesterKey] = req.UserInfo.Username
+}
+
+func labelChanged(oldCluster, cluster *capi.Cluster, key string) bool {
+	if oldCluster == nil {
+		_, ok := cluster.Labels[key]
+		return ok
+	}
+
+	return valueChanged(oldCluster.Labels, cluster.Labels, key)
+}
+
+func annotationChanged(oldCluster, cluster *capi.Cluster, key string) bool {
+	if oldCluster == nil {
+		_, ok := cluster.Annotations[key]
+		return ok
+	}
+
+	return valueChanged(oldCluster.Annotations, cluster.Annotations, key)
+}
+
+func valueChanged(oldValues, values map[string]string, key string) bool {
+	oldValue, oldOK := oldValues[key]
+	value, ok := values[key]
+
+	return oldOK != ok || oldValue != value
+}
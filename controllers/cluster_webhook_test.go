@@ -0,0 +1,380 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	testingclock "k8s.io/utils/clock/testing"
+	capi "sigs.k8s.io/cluster-api/api/core/v1beta2"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/giantswarm/cluster-cleaner/pkg/policy"
+)
+
+func TestClusterValidator(t *testing.T) {
+	now := time.Date(2022, 2, 1, 12, 0, 0, 0, time.UTC)
+	validator := &ClusterValidator{
+		Options: Options{
+			Config: policy.Config{MaxKeepUntilHorizon: 30 * 24 * time.Hour},
+		},
+		IgnoreAllowedGroups: []string{"giantswarm:admins"},
+		ControllerUsername:  "system:serviceaccount:giantswarm:cluster-cleaner",
+		Clock:               testingclock.NewFakePassiveClock(now),
+	}
+
+	testCases := []struct {
+		name          string
+		user          authenticationv1.UserInfo
+		oldCluster    *capi.Cluster
+		cluster       *capi.Cluster
+		expectedError bool
+	}{
+		{
+			name:    "case 0 - no cleanup settings",
+			cluster: newWebhookTestCluster(nil, nil),
+		},
+		{
+			name:    "case 1 - valid keep-until label",
+			cluster: newWebhookTestCluster(map[string]string{keepUntil: now.UTC().Format(keepUntilTimeLayout)}, nil),
+		},
+		{
+			name:          "case 2 - invalid keep-until label",
+			cluster:       newWebhookTestCluster(map[string]string{keepUntil: "next-friday"}, nil),
+			expectedError: true,
+		},
+		{
+			name:          "case 3 - keep-until label beyond horizon",
+			cluster:       newWebhookTestCluster(map[string]string{keepUntil: "2099-01-01"}, nil),
+			expectedError: true,
+		},
+		{
+			name: "case 4 - invalid keep-until time zone",
+			cluster: newWebhookTestCluster(nil, map[string]string{
+				keepUntilAnnotation:         now.Format("2006-01-02T15:04"),
+				keepUntilTimezoneAnnotation: "Mars/Olympus_Mons",
+			}),
+			expectedError: true,
+		},
+		{
+			name:          "case 5 - invalid ttl",
+			cluster:       newWebhookTestCluster(nil, map[string]string{clusterTTL: "a while"}),
+			expectedError: true,
+		},
+		{
+			name:          "case 6 - unauthorized ignore annotation",
+			user:          authenticationv1.UserInfo{Username: "dev", Groups: []string{"developers"}},
+			cluster:       newWebhookTestCluster(nil, map[string]string{ignoreClusterDeletion: "true"}),
+			expectedError: true,
+		},
+		{
+			name:    "case 7 - authorized ignore annotation",
+			user:    authenticationv1.UserInfo{Username: "admin", Groups: []string{"giantswarm:admins"}},
+			cluster: newWebhookTestCluster(nil, map[string]string{ignoreClusterDeletion: "true"}),
+		},
+		{
+			name:          "case 8 - invalid ignore annotation expiry",
+			user:          authenticationv1.UserInfo{Username: "admin", Groups: []string{"giantswarm:admins"}},
+			cluster:       newWebhookTestCluster(nil, map[string]string{ignoreClusterDeletion: "until friday"}),
+			expectedError: true,
+		},
+		{
+			name:       "case 9 - unchanged invalid values are allowed",
+			user:       authenticationv1.UserInfo{Username: "capi-controller"},
+			oldCluster: newWebhookTestCluster(map[string]string{keepUntil: "2099-01-01"}, map[string]string{ignoreClusterDeletion: "true"}),
+			cluster:    newWebhookTestCluster(map[string]string{keepUntil: "2099-01-01"}, map[string]string{ignoreClusterDeletion: "true"}),
+		},
+		{
+			name:          "case 10 - changed keep-until label beyond horizon",
+			oldCluster:    newWebhookTestCluster(map[string]string{keepUntil: "2020-01-01"}, nil),
+			cluster:       newWebhookTestCluster(map[string]string{keepUntil: "2099-01-01"}, nil),
+			expectedError: true,
+		},
+		{
+			name:    "case 11 - valid extension",
+			cluster: newWebhookTestCluster(nil, map[string]string{extendByAnnotation: "2h"}),
+		},
+		{
+			name:          "case 12 - invalid extension",
+			cluster:       newWebhookTestCluster(nil, map[string]string{extendByAnnotation: "-2h"}),
+			expectedError: true,
+		},
+		{
+			name:          "case 13 - keep-until observation reset by a user",
+			user:          authenticationv1.UserInfo{Username: "alice"},
+			oldCluster:    newWebhookTestCluster(nil, map[string]string{keepUntilObservedAnnotation: "2022-02-01T12:00:00Z/2022-02-02T12:00:00Z"}),
+			cluster:       newWebhookTestCluster(nil, map[string]string{}),
+			expectedError: true,
+		},
+		{
+			name:       "case 14 - keep-until observation recorded by the controller",
+			user:       authenticationv1.UserInfo{Username: "system:serviceaccount:giantswarm:cluster-cleaner"},
+			oldCluster: newWebhookTestCluster(nil, map[string]string{}),
+			cluster:    newWebhookTestCluster(nil, map[string]string{keepUntilObservedAnnotation: "2022-02-01T12:00:00Z/2022-02-02T12:00:00Z"}),
+		},
+		{
+			name:          "case 15 - extension budget reset by a user",
+			user:          authenticationv1.UserInfo{Username: "alice"},
+			oldCluster:    newWebhookTestCluster(nil, map[string]string{extensionsAnnotation: "3", extendedTotalAnnotation: "72h0m0s"}),
+			cluster:       newWebhookTestCluster(nil, map[string]string{extensionsAnnotation: "0", extendedTotalAnnotation: "0s"}),
+			expectedError: true,
+		},
+		{
+			name:       "case 16 - extension requested by the user",
+			user:       authenticationv1.UserInfo{Username: "alice"},
+			oldCluster: newWebhookTestCluster(nil, map[string]string{}),
+			cluster:    newWebhookTestCluster(nil, map[string]string{extendByAnnotation: "2h", extendRequestedByAnnotation: "alice"}),
+		},
+		{
+			name:          "case 17 - extension requested on behalf of another user",
+			user:          authenticationv1.UserInfo{Username: "alice"},
+			oldCluster:    newWebhookTestCluster(nil, map[string]string{}),
+			cluster:       newWebhookTestCluster(nil, map[string]string{extendByAnnotation: "2h", extendRequestedByAnnotation: "bob"}),
+			expectedError: true,
+		},
+		{
+			name:       "case 18 - deletion requested by the user",
+			user:       authenticationv1.UserInfo{Username: "alice"},
+			oldCluster: newWebhookTestCluster(nil, map[string]string{}),
+			cluster:    newWebhookTestCluster(nil, map[string]string{deleteNowAnnotation: "true", deleteRequestedByAnnotation: "alice"}),
+		},
+		{
+			name:          "case 19 - deletion requested on behalf of another user",
+			user:          authenticationv1.UserInfo{Username: "alice"},
+			oldCluster:    newWebhookTestCluster(nil, map[string]string{}),
+			cluster:       newWebhookTestCluster(nil, map[string]string{deleteNowAnnotation: "true", deleteRequestedByAnnotation: "bob"}),
+			expectedError: true,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			ctx := admission.NewContextWithRequest(context.TODO(), admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{UserInfo: tc.user},
+			})
+
+			var err error
+			if tc.oldCluster == nil {
+				_, err = validator.ValidateCreate(ctx, tc.cluster)
+			} else {
+				_, err = validator.ValidateUpdate(ctx, tc.oldCluster, tc.cluster)
+			}
+			assert.Equal(t, tc.expectedError, err != nil, "test case %v failed. unexpected error %v", tc.name, err)
+		})
+	}
+}
+
+func newWebhookTestCluster(labels, annotations map[string]string) *capi.Cluster {
+	return &capi.Cluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "test",
+			Namespace:   "default",
+			Labels:      labels,
+			Annotations: annotations,
+		},
+	}
+}
+
+func TestClusterDefaulter(t *testing.T) {
+	now := time.Date(2022, 2, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name             string
+		labels           map[string]string
+		annotations      map[string]string
+		expectedDeadline time.Duration
+		expectedFound    bool
+	}{
+		{
+			name:             "case 0 - default ttl",
+			expectedDeadline: defaultTTL,
+			expectedFound:    true,
+		},
+		{
+			name:             "case 1 - cluster ttl",
+			annotations:      map[string]string{clusterTTL: "10h"},
+			expectedDeadline: 10 * time.Hour,
+			expectedFound:    true,
+		},
+		{
+			name:          "case 2 - ignored",
+			annotations:   map[string]string{ignoreClusterDeletion: "true"},
+			expectedFound: false,
+		},
+		{
+			name:          "case 3 - flux",
+			labels:        map[string]string{fluxLabel: "flux"},
+			expectedFound: false,
+		},
+		{
+			name:             "case 4 - keep-until after ttl",
+			annotations:      map[string]string{keepUntilAnnotation: now.Add(48 * time.Hour).UTC().Format(time.RFC3339)},
+			expectedDeadline: 48 * time.Hour,
+			expectedFound:    true,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			defaulter := &ClusterDefaulter{
+				Client: fake.NewClientBuilder().WithScheme(fakeScheme).Build(),
+				Clock:  testingclock.NewFakePassiveClock(now),
+			}
+			cluster := newWebhookTestCluster(tc.labels, tc.annotations)
+
+			err := defaulter.Default(context.TODO(), cluster)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			v, found := cluster.Annotations[deleteAfterAnnotation]
+			assert.Equal(t, tc.expectedFound, found, "test case %v failed.", tc.name)
+			if !tc.expectedFound {
+				return
+			}
+			deadline, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.True(t, now.Add(tc.expectedDeadline).Equal(deadline), "test case %v failed. expected %v, got %v", tc.name, now.Add(tc.expectedDeadline), deadline)
+		})
+	}
+}
+
+func TestClusterDefaulterOwner(t *testing.T) {
+	now := time.Date(2022, 2, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name          string
+		annotations   map[string]string
+		username      string
+		expectedOwner string
+	}{
+		{
+			name:          "case 0 - user",
+			username:      "alice@example.com",
+			expectedOwner: "alice@example.com",
+		},
+		{
+			name:          "case 1 - service account",
+			username:      "system:serviceaccount:giantswarm:chart-operator",
+			expectedOwner: "",
+		},
+		{
+			name:          "case 2 - creator annotation",
+			annotations:   map[string]string{creatorAnnotation: "bob@example.com"},
+			username:      "alice@example.com",
+			expectedOwner: "",
+		},
+		{
+			name:          "case 3 - owner annotation",
+			annotations:   map[string]string{ownerAnnotation: "bob@example.com"},
+			username:      "alice@example.com",
+			expectedOwner: "bob@example.com",
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			defaulter := &ClusterDefaulter{
+				Client: fake.NewClientBuilder().WithScheme(fakeScheme).Build(),
+				Clock:  testingclock.NewFakePassiveClock(now),
+			}
+			cluster := newWebhookTestCluster(nil, tc.annotations)
+			ctx := admission.NewContextWithRequest(context.TODO(), admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{UserInfo: authenticationv1.UserInfo{Username: tc.username}},
+			})
+
+			err := defaulter.Default(ctx, cluster)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, tc.expectedOwner, cluster.Annotations[ownerAnnotation], "test case %v failed.", tc.name)
+		})
+	}
+}
+
+func TestClusterDefaulterRequester(t *testing.T) {
+	now := time.Date(2022, 2, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name              string
+		oldAnnotations    map[string]string
+		annotations       map[string]string
+		expectedRequester string
+		// expectedDeleteRequester is the expected requester of the deletion of the cluster
+		expectedDeleteRequester string
+	}{
+		{
+			name:              "case 0 - extension requested",
+			oldAnnotations:    map[string]string{},
+			annotations:       map[string]string{extendByAnnotation: "2h"},
+			expectedRequester: "alice@example.com",
+		},
+		{
+			name:              "case 1 - extension requested by another user before",
+			oldAnnotations:    map[string]string{extendByAnnotation: "2h", extendRequestedByAnnotation: "bob@example.com"},
+			annotations:       map[string]string{extendByAnnotation: "2h", extendRequestedByAnnotation: "bob@example.com"},
+			expectedRequester: "bob@example.com",
+		},
+		{
+			name:              "case 2 - extension changed",
+			oldAnnotations:    map[string]string{extendByAnnotation: "2h", extendRequestedByAnnotation: "bob@example.com"},
+			annotations:       map[string]string{extendByAnnotation: "4h", extendRequestedByAnnotation: "bob@example.com"},
+			expectedRequester: "alice@example.com",
+		},
+		{
+			name:              "case 3 - no extension",
+			oldAnnotations:    map[string]string{},
+			annotations:       map[string]string{clusterTTL: "8h"},
+			expectedRequester: "",
+		},
+		{
+			name:                    "case 4 - deletion requested",
+			oldAnnotations:          map[string]string{},
+			annotations:             map[string]string{deleteNowAnnotation: "true"},
+			expectedDeleteRequester: "alice@example.com",
+		},
+		{
+			name:                    "case 5 - deletion requested by another user before",
+			oldAnnotations:          map[string]string{deleteNowAnnotation: "true", deleteRequestedByAnnotation: "bob@example.com"},
+			annotations:             map[string]string{deleteNowAnnotation: "true", deleteRequestedByAnnotation: "bob@example.com"},
+			expectedDeleteRequester: "bob@example.com",
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			defaulter := &ClusterDefaulter{
+				Client: fake.NewClientBuilder().WithScheme(fakeScheme).Build(),
+				Clock:  testingclock.NewFakePassiveClock(now),
+			}
+			oldCluster, err := json.Marshal(newWebhookTestCluster(nil, tc.oldAnnotations))
+			if err != nil {
+				t.Fatal(err)
+			}
+			cluster := newWebhookTestCluster(nil, tc.annotations)
+			ctx := admission.NewContextWithRequest(context.TODO(), admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Operation: admissionv1.Update,
+					UserInfo:  authenticationv1.UserInfo{Username: "alice@example.com"},
+					OldObject: runtime.RawExtension{Raw: oldCluster},
+				},
+			})
+
+			err = defaulter.Default(ctx, cluster)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, tc.expectedRequester, cluster.Annotations[extendRequestedByAnnotation], "test case %v failed.", tc.name)
+			assert.Equal(t, tc.expectedDeleteRequester, cluster.Annotations[deleteRequestedByAnnotation], "test case %v failed.", tc.name)
+			assert.NotContains(t, cluster.Annotations, deleteAfterAnnotation, "test case %v failed.", tc.name)
+		})
+	}
+}
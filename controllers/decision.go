@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/giantswarm/cluster-cleaner/pkg/policy"
+)
+
+// ignoredReason returns the reason an ignored cluster is reported with in notifications.
+func ignoredReason(d policy.Decision) string {
+	switch d.Reason {
+	case policy.DecisionFluxManaged:
+		return ignoredReasonFlux
+	case policy.DecisionIgnoreAnnotation:
+		return ignoredReasonAnnotation
+	case policy.DecisionIgnoreRule:
+		return ignoredReasonPolicy
+	case policy.DecisionInvalidKeepUntil:
+		return ignoredReasonInvalidKeepUntil
+	case policy.DecisionTooOld:
+		return ignoredReasonMaxAge
+	case policy.DecisionNoChartAnnotation:
+		return ignoredReasonNoChartAnnotation
+	case policy.DecisionNoApp:
+		return ignoredReasonNoApp
+	}
+
+	return ""
+}
+
+// decisionLogValues returns the key value pairs the decision is logged with.
+func decisionLogValues(d policy.Decision) []any {
+	values := []any{"decision", d.Reason}
+	if d.Detail != "" {
+		values = append(values, "detail", d.Detail)
+	}
+	if !d.Deadline.IsZero() {
+		values = append(values, "deadline", d.Deadline.UTC().Format(time.RFC3339))
+	}
+	if !d.IgnoreExpiry.IsZero() {
+		values = append(values, "ignoreExpiry", d.IgnoreExpiry.UTC().Format(time.RFC3339))
+	}
+	if !d.KeepUntil.IsZero() {
+		values = append(values, "keepUntil", d.KeepUntil.UTC().Format(time.RFC3339), "keepUntilSource", d.KeepUntilSource)
+	}
+	if d.KeepUntilClamped {
+		values = append(values, "keepUntilClamped", true)
+	}
+	if d.InvalidKeepUntil != nil {
+		values = append(values, "invalidKeepUntil", d.InvalidKeepUntil.Error())
+	}
+	if d.InvalidTTL != nil {
+		values = append(values, "invalidTTL", d.InvalidTTL.Error())
+	}
+
+	return values
+}
@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/tools/record"
+	testingclock "k8s.io/utils/clock/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/giantswarm/cluster-cleaner/pkg/policy"
+)
+
+func TestDecisionsTotal(t *testing.T) {
+	now := time.Date(2022, 2, 1, 12, 0, 0, 0, time.UTC)
+	cluster := newTestCluster("decisions", "default", now, map[string]string{fluxLabel: "flux"})
+	r := &ClusterReconciler{
+		Client:   fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(cluster).Build(),
+		Scheme:   fakeScheme,
+		Log:      ctrl.Log.WithName("fake"),
+		Clock:    testingclock.NewFakePassiveClock(now),
+		recorder: record.NewFakeRecorder(10),
+	}
+
+	before := decisionsTotal(t, policy.DecisionFluxManaged)
+	for range 2 {
+		if _, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: ctrlKey(cluster)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Equal(t, before+2, decisionsTotal(t, policy.DecisionFluxManaged))
+}
+
+func decisionsTotal(t *testing.T, reason policy.DecisionReason) float64 {
+	m := &dto.Metric{}
+	if err := DecisionsTotal.WithLabelValues(string(reason)).Write(m); err != nil {
+		t.Fatal(err)
+	}
+
+	return m.GetCounter().GetValue()
+}
@@ -0,0 +1,150 @@
+package controllers
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	capi "sigs.k8s.io/cluster-api/api/core/v1beta2"
+
+	"github.com/giantswarm/cluster-cleaner/pkg/notification"
+	"github.com/giantswarm/cluster-cleaner/pkg/policy"
+)
+
+// digestWindow is how far ahead the digest lists upcoming deletions.
+const digestWindow = 24 * time.Hour
+
+// DigestReporter sends a digest of all clusters once a day: the clusters deleted within the next 24 hours, the
+// ignored clusters, the clusters protected by `keep-until` and the clusters whose deletion failed. It is computed from
+// the cache of the reconciler and sent with its notifier. It implements manager.Runnable and runs on the leader only.
+type DigestReporter struct {
+	reconciler *ClusterReconciler
+	at         time.Duration
+}
+
+// NewDigestReporter returns a DigestReporter for the clusters of the reconciler, sending the digest at the given time
+// of day in UTC, e.g. 8h for 08:00 UTC.
+func NewDigestReporter(r *ClusterReconciler, at time.Duration) *DigestReporter {
+	return &DigestReporter{reconciler: r, at: at}
+}
+
+// Start sends the digest every day until the context is cancelled.
+func (d *DigestReporter) Start(ctx context.Context) error {
+	log := d.reconciler.Log.WithName("digest")
+	for {
+		now := currentTime(d.reconciler.Clock)
+		timer := time.NewTimer(nextDigest(now, d.at).Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+
+		if err := d.send(ctx); err != nil {
+			log.Error(err, "failed sending digest")
+		}
+	}
+}
+
+func (d *DigestReporter) send(ctx context.Context) error {
+	now := currentTime(d.reconciler.Clock)
+	digest, err := d.digest(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	d.reconciler.notify(notification.Notification{
+		Kind:    notification.KindDigest,
+		Message: digest.Summary(),
+		Time:    now,
+		Digest:  &digest,
+	})
+
+	return nil
+}
+
+// digest returns the digest of all clusters at the given time.
+func (d *DigestReporter) digest(ctx context.Context, now time.Time) (notification.Digest, error) {
+	r := d.reconciler
+	digest := notification.Digest{
+		Time:      now,
+		Until:     now.Add(digestWindow),
+		Deleting:  []notification.DigestEntry{},
+		Ignored:   []notification.DigestEntry{},
+		Protected: []notification.DigestEntry{},
+		Failed:    []notification.DigestEntry{},
+	}
+
+	clusters := &capi.ClusterList{}
+	if err := r.List(ctx, clusters); err != nil {
+		return notification.Digest{}, errors.Wrap(err, "failed listing clusters")
+	}
+	failed := r.notified.recorded(notification.KindFailed)
+
+	for i := range clusters.Items {
+		cluster := &clusters.Items[i]
+		entry := notification.DigestEntry{
+			Cluster:   cluster.Name,
+			Namespace: cluster.Namespace,
+			Owner:     cluster.Annotations[ownerAnnotation],
+		}
+
+		if message, ok := failed[ctrlKey(cluster)]; ok {
+			entry.Message = message
+			digest.Failed = append(digest.Failed, entry)
+			continue
+		}
+		if !cluster.DeletionTimestamp.IsZero() {
+			continue
+		}
+
+		s, err := resolveSettings(ctx, r.Client, cluster)
+		if err != nil {
+			return notification.Digest{}, err
+		}
+		app, err := getClusterApp(ctx, r.Client, cluster)
+		if err != nil {
+			return notification.Digest{}, err
+		}
+		decision := policy.EvaluateSettings(cluster, app, s, now, r.Config)
+		entry.Deadline = decision.Deadline
+
+		switch {
+		case decision.Reason == policy.DecisionKeepUntil:
+			digest.Protected = append(digest.Protected, entry)
+		case decision.Ignored():
+			// only clusters with an expiring ignore annotation are going to be deleted
+			if decision.Reason != policy.DecisionIgnoreAnnotation {
+				entry.Deadline = time.Time{}
+			}
+			entry.Reason = ignoredReason(decision)
+			digest.Ignored = append(digest.Ignored, entry)
+		case !decision.Deadline.IsZero() && decision.Deadline.Before(digest.Until):
+			digest.Deleting = append(digest.Deleting, entry)
+		}
+	}
+
+	slices.SortStableFunc(digest.Deleting, func(a, b notification.DigestEntry) int {
+		return a.Deadline.Compare(b.Deadline)
+	})
+	for _, entries := range [][]notification.DigestEntry{digest.Ignored, digest.Protected, digest.Failed} {
+		slices.SortFunc(entries, func(a, b notification.DigestEntry) int {
+			return strings.Compare(a.Namespace+"/"+a.Cluster, b.Namespace+"/"+b.Cluster)
+		})
+	}
+
+	return digest, nil
+}
+
+// nextDigest returns the next time of day the digest is sent at after now.
+func nextDigest(now time.Time, at time.Duration) time.Time {
+	next := now.UTC().Truncate(24 * time.Hour).Add(at)
+	if !next.After(now) {
+		next = next.Add(24 * time.Hour)
+	}
+
+	return next
+}
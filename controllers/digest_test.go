@@ -0,0 +1,190 @@
+package controllers
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	testingclock "k8s.io/utils/clock/testing"
+	capi "sigs.k8s.io/cluster-api/api/core/v1beta2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/giantswarm/cluster-cleaner/pkg/notification"
+)
+
+func TestDigest(t *testing.T) {
+	now := time.Date(2022, 2, 1, 8, 0, 0, 0, time.UTC)
+
+	withAnnotations := func(cluster *capi.Cluster, annotations map[string]string) *capi.Cluster {
+		for k, v := range annotations {
+			cluster.Annotations[k] = v
+		}
+		return cluster
+	}
+	clusters := []ctrlclient.Object{
+		withAnnotations(newTestCluster("soon", "org-acme", now.Add(-defaultTTL+time.Hour), nil), map[string]string{ownerAnnotation: "alice@example.com"}),
+		newTestCluster("sooner", "org-acme", now.Add(-defaultTTL+time.Minute), nil),
+		newTestCluster("later", "org-acme", now, map[string]string{clusterTTL: "48h"}),
+		newTestCluster("flux", "org-acme", now, map[string]string{fluxLabel: "flux"}),
+		withAnnotations(newTestCluster("ignored", "org-acme", now, nil), map[string]string{ignoreClusterDeletion: "true"}),
+		withAnnotations(newTestCluster("kept", "org-acme", now.Add(-defaultTTL), nil), map[string]string{keepUntilAnnotation: now.Add(48 * time.Hour).Format(time.RFC3339)}),
+		newTestCluster("invalid", "org-acme", now, map[string]string{keepUntil: "tomorrow"}),
+		newTestCluster("old", "org-acme", now.Add(-defaultMaxAge-time.Hour), nil),
+		newTestCluster("broken", "org-other", now.Add(-defaultTTL), nil),
+	}
+	r := &ClusterReconciler{
+		Client: fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(clusters...).Build(),
+		Scheme: fakeScheme,
+		Log:    ctrl.Log.WithName("fake"),
+		Clock:  testingclock.NewFakePassiveClock(now),
+	}
+	r.notified.changed(ctrlKey(clusters[8].(*capi.Cluster)), notification.KindFailed, "failed deleting cluster")
+
+	digest, err := NewDigestReporter(r, 8*time.Hour).digest(context.TODO(), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, notification.Digest{
+		Time:  now,
+		Until: now.Add(24 * time.Hour),
+		Deleting: []notification.DigestEntry{
+			{Cluster: "sooner", Namespace: "org-acme", Deadline: now.Add(time.Minute)},
+			{Cluster: "soon", Namespace: "org-acme", Owner: "alice@example.com", Deadline: now.Add(time.Hour)},
+		},
+		Ignored: []notification.DigestEntry{
+			{Cluster: "flux", Namespace: "org-acme", Reason: ignoredReasonFlux},
+			{Cluster: "ignored", Namespace: "org-acme", Reason: ignoredReasonAnnotation},
+			{Cluster: "invalid", Namespace: "org-acme", Reason: ignoredReasonInvalidKeepUntil},
+			{Cluster: "old", Namespace: "org-acme", Reason: ignoredReasonMaxAge},
+		},
+		Protected: []notification.DigestEntry{
+			{Cluster: "kept", Namespace: "org-acme", Deadline: now.Add(48 * time.Hour)},
+		},
+		Failed: []notification.DigestEntry{
+			{Cluster: "broken", Namespace: "org-other", Message: "failed deleting cluster"},
+		},
+	}, digest)
+}
+
+func TestDigestSent(t *testing.T) {
+	now := time.Date(2022, 2, 1, 8, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name         string
+		dryRun       bool
+		expectedSent bool
+	}{
+		{
+			name:         "case 0 - sent",
+			expectedSent: true,
+		},
+		{
+			name:   "case 1 - dry run",
+			dryRun: true,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			notifier := &recordingNotifier{}
+			r := &ClusterReconciler{
+				Client:   fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(newTestCluster("test", "default", now, nil)).Build(),
+				Scheme:   fakeScheme,
+				Log:      ctrl.Log.WithName("fake"),
+				DryRun:   tc.dryRun,
+				Clock:    testingclock.NewFakePassiveClock(now),
+				Notifier: notifier,
+			}
+
+			if err := NewDigestReporter(r, 8*time.Hour).send(context.TODO()); err != nil {
+				t.Fatal(err)
+			}
+
+			if !tc.expectedSent {
+				assert.Empty(t, notifier.notifications, "test case %v failed.", tc.name)
+				return
+			}
+			if !assert.Len(t, notifier.notifications, 1, "test case %v failed.", tc.name) {
+				return
+			}
+			n := notifier.notifications[0]
+			assert.Equal(t, notification.KindDigest, n.Kind, "test case %v failed.", tc.name)
+			assert.Equal(t, now, n.Time, "test case %v failed.", tc.name)
+			if assert.NotNil(t, n.Digest, "test case %v failed.", tc.name) {
+				assert.Equal(t, n.Digest.Summary(), n.Message, "test case %v failed.", tc.name)
+			}
+		})
+	}
+}
+
+func TestNextDigest(t *testing.T) {
+	testCases := []struct {
+		name     string
+		now      time.Time
+		at       time.Duration
+		expected time.Time
+	}{
+		{
+			name:     "case 0 - later today",
+			now:      time.Date(2022, 2, 1, 6, 30, 0, 0, time.UTC),
+			at:       8 * time.Hour,
+			expected: time.Date(2022, 2, 1, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "case 1 - tomorrow",
+			now:      time.Date(2022, 2, 1, 8, 0, 0, 0, time.UTC),
+			at:       8 * time.Hour,
+			expected: time.Date(2022, 2, 2, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "case 2 - midnight",
+			now:      time.Date(2022, 2, 1, 23, 59, 0, 0, time.UTC),
+			expected: time.Date(2022, 2, 2, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, tc.expected, nextDigest(tc.now, tc.at), "test case %v failed.", tc.name)
+		})
+	}
+}
+
+func TestParseDigestTime(t *testing.T) {
+	testCases := []struct {
+		name          string
+		value         string
+		expected      time.Duration
+		expectedError bool
+	}{
+		{
+			name:     "case 0 - time of day",
+			value:    "08:30",
+			expected: 8*time.Hour + 30*time.Minute,
+		},
+		{
+			name:          "case 1 - duration",
+			value:         "8h",
+			expectedError: true,
+		},
+		{
+			name:          "case 2 - out of range",
+			value:         "24:00",
+			expectedError: true,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			at, err := ParseDigestTime(tc.value)
+			if tc.expectedError {
+				assert.Error(t, err, "test case %v failed.", tc.name)
+				return
+			}
+			assert.NoError(t, err, "test case %v failed.", tc.name)
+			assert.Equal(t, tc.expected, at, "test case %v failed.", tc.name)
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	gsapplication "github.com/giantswarm/apiextensions-application/api/v1alpha1"
+	capi "sigs.k8s.io/cluster-api/api/core/v1beta2"
+)
+
+// event records an event about the cluster with the named message, which is returned to be reused in notifications.
+// The name of the message is the reason of the event. The event is recorded on the App CR of the cluster as well, so
+// it is seen by users who only look at the App.
+func (r *ClusterReconciler) event(ctx context.Context, cluster *capi.Cluster, eventType, name string, deadline, now time.Time, fields messageFields) string {
+	message := r.message(name, cluster, deadline, now, fields)
+	r.recorder.Event(cluster, eventType, name, message)
+	if app := r.clusterApp(ctx, cluster); app != nil {
+		r.recorder.Event(app, eventType, name, message)
+	}
+
+	return message
+}
+
+// clusterApp returns the App CR of the cluster, or nil if the cluster was not created from an App.
+func (r *ClusterReconciler) clusterApp(ctx context.Context, cluster *capi.Cluster) *gsapplication.App {
+	app, err := getClusterApp(ctx, r.Client, cluster)
+	if err != nil {
+		r.Log.Error(err, "failed getting cluster App CR for event", "cluster", ctrlKey(cluster))
+	}
+
+	return app
+}
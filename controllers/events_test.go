@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	gsapplication "github.com/giantswarm/apiextensions-application/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	testingclock "k8s.io/utils/clock/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// objectRecorder records events together with the object they are about.
+type objectRecorder struct {
+	events []string
+}
+
+func (o *objectRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	var kind string
+	switch object.(type) {
+	case *gsapplication.App:
+		kind = "App"
+	default:
+		kind = "Cluster"
+	}
+	o.events = append(o.events, fmt.Sprintf("%s %s %s %s", kind, eventtype, reason, message))
+}
+
+func (o *objectRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...any) {
+	o.Event(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func (o *objectRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...any) {
+	o.Event(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func TestClusterEvents(t *testing.T) {
+	now := time.Date(2022, 2, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name             string
+		created          time.Duration
+		chartAnnotations bool
+		withApp          bool
+		failDeletion     bool
+		expectedEvents   []string
+	}{
+		{
+			name:             "case 0 - marked cluster with App CR",
+			created:          time.Hour - defaultTTL,
+			chartAnnotations: true,
+			withApp:          true,
+			expectedEvents: []string{
+				"Cluster Normal ClusterMarkedForDeletion Cluster will be deleted in aprox. 60 min.",
+				"App Normal ClusterMarkedForDeletion Cluster will be deleted in aprox. 60 min.",
+			},
+		},
+		{
+			name:             "case 1 - marked cluster without App CR",
+			created:          time.Hour - defaultTTL,
+			chartAnnotations: true,
+			expectedEvents: []string{
+				"Cluster Normal ClusterMarkedForDeletion Cluster will be deleted in aprox. 60 min.",
+			},
+		},
+		{
+			name:    "case 2 - marked cluster without chart annotations",
+			created: time.Hour - defaultTTL,
+			withApp: true,
+			expectedEvents: []string{
+				"Cluster Normal ClusterMarkedForDeletion Cluster will be deleted in aprox. 60 min.",
+			},
+		},
+		{
+			name:             "case 3 - failed deletion",
+			created:          -defaultTTL,
+			chartAnnotations: true,
+			withApp:          true,
+			failDeletion:     true,
+			expectedEvents: []string{
+				"Cluster Warning ClusterDeletionFailed Deletion of the cluster failed: deletion failed",
+				"App Warning ClusterDeletionFailed Deletion of the cluster failed: deletion failed",
+			},
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			cluster := newTestCluster("test", "default", now.Add(tc.created), nil)
+			if tc.chartAnnotations {
+				cluster.Annotations[helmReleaseNameAnnotation] = "test"
+				cluster.Annotations[helmReleaseNamespaceAnnotation] = "default"
+			}
+			objects := []ctrlclient.Object{cluster}
+			if tc.withApp {
+				objects = append(objects, &gsapplication.App{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"}})
+			}
+			builder := fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(objects...)
+			if tc.failDeletion {
+				builder = builder.WithInterceptorFuncs(interceptor.Funcs{
+					Delete: func(ctx context.Context, client ctrlclient.WithWatch, obj ctrlclient.Object, opts ...ctrlclient.DeleteOption) error {
+						return errors.New("deletion failed")
+					},
+				})
+			}
+			recorder := &objectRecorder{}
+			r := &ClusterReconciler{
+				Client:   builder.Build(),
+				Scheme:   fakeScheme,
+				Log:      ctrl.Log.WithName("fake"),
+				Clock:    testingclock.NewFakePassiveClock(now),
+				recorder: recorder,
+			}
+
+			_, _ = r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: types.NamespacedName{Name: cluster.Name, Namespace: cluster.Namespace}})
+
+			assert.Equal(t, tc.expectedEvents, recorder.events, "test case %v failed.", tc.name)
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	capi "sigs.k8s.io/cluster-api/api/core/v1beta2"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/giantswarm/cluster-cleaner/pkg/policy"
+)
+
+// applyExtension consumes the extend-by annotation of the cluster. The requested duration is added to the current
+// deletion deadline, which is stored in the `keep-until` annotation, unless the extension budget of the cluster
+// is exhausted. Extensions are clamped to the maximum keep-until horizon. The extend-by annotation is removed in any
+// case.
+func (r *ClusterReconciler) applyExtension(ctx context.Context, log logr.Logger, cluster *capi.Cluster, s policy.Settings, now time.Time) error {
+	v, ok := cluster.Annotations[extendByAnnotation]
+	if !ok {
+		return nil
+	}
+
+	patch := ctrlclient.MergeFrom(cluster.DeepCopy())
+	requester := cluster.Annotations[extendRequestedByAnnotation]
+	if requester == "" {
+		requester, _ = policy.AnnotationManager(cluster, extendByAnnotation)
+	}
+	delete(cluster.Annotations, extendByAnnotation)
+	delete(cluster.Annotations, extendRequestedByAnnotation)
+
+	extension, err := parseExtendBy(v)
+	if err != nil {
+		log.Error(err, "failed to parse extension for cluster")
+		r.event(ctx, cluster, corev1.EventTypeWarning, messageExtensionRefused, time.Time{}, now,
+			messageFields{Refusal: refusalInvalid, Error: err.Error(), Requester: requester})
+		return r.patchExtension(ctx, cluster, patch)
+	}
+
+	deadline, ok := policy.Deadline(cluster, s, r.Config, now)
+	if !ok {
+		log.Info(fmt.Sprintf("Found annotation %s, but cluster is not going to be deleted", extendByAnnotation))
+		r.event(ctx, cluster, corev1.EventTypeWarning, messageExtensionRefused, time.Time{}, now,
+			messageFields{Refusal: refusalNotNeeded, Requester: requester, Extension: extension})
+		return r.patchExtension(ctx, cluster, patch)
+	}
+
+	if deadline.Before(now) {
+		deadline = now
+	}
+
+	// clamp the extension to the maximum keep-until horizon, the webhook would reject the keep-until value otherwise
+	keepUntilTime := deadline.Add(extension).UTC().Truncate(time.Second)
+	clamped := false
+	if limit, ok := policy.MaxKeepUntil(cluster, policy.CreationTime(cluster), r.Config, now); ok && keepUntilTime.After(limit) {
+		if !limit.After(deadline) {
+			log.Info(fmt.Sprintf("Extension by %s requested by %s exceeds the maximum keep-until horizon of %s", extension, requester, r.MaxKeepUntilHorizon))
+			r.event(ctx, cluster, corev1.EventTypeWarning, messageExtensionRefused, deadline, now, messageFields{
+				Refusal:   refusalHorizon,
+				Requester: requester,
+				Extension: extension,
+				Horizon:   r.MaxKeepUntilHorizon,
+				Basis:     r.maxKeepUntilBasis(),
+			})
+			return r.patchExtension(ctx, cluster, patch)
+		}
+		keepUntilTime = limit.UTC()
+		extension = keepUntilTime.Sub(deadline)
+		clamped = true
+	}
+
+	total := getExtendedTotal(cluster) + extension
+	if r.ExtensionBudget > 0 && total > r.ExtensionBudget {
+		log.Info(fmt.Sprintf("Extension by %s requested by %s exceeds the extension budget of %s", extension, requester, r.ExtensionBudget))
+		r.event(ctx, cluster, corev1.EventTypeWarning, messageExtensionRefused, deadline, now, messageFields{
+			Refusal:   refusalBudget,
+			Requester: requester,
+			Extension: extension,
+			Count:     getExtensions(cluster),
+			Total:     getExtendedTotal(cluster),
+			Budget:    r.ExtensionBudget,
+		})
+		return r.patchExtension(ctx, cluster, patch)
+	}
+
+	count := getExtensions(cluster) + 1
+
+	cluster.Annotations[keepUntilAnnotation] = keepUntilTime.Format(time.RFC3339)
+	delete(cluster.Annotations, keepUntilTimezoneAnnotation)
+	cluster.Annotations[extensionsAnnotation] = strconv.Itoa(count)
+	cluster.Annotations[extendedTotalAnnotation] = total.String()
+	cluster.Annotations[lastExtendedByAnnotation] = requester
+
+	if clamped {
+		r.event(ctx, cluster, corev1.EventTypeWarning, messageKeepUntilClamped, keepUntilTime, now, messageFields{
+			Requester: requester,
+			Extension: extension,
+			Horizon:   r.MaxKeepUntilHorizon,
+			Basis:     r.maxKeepUntilBasis(),
+		})
+	}
+	log.Info(fmt.Sprintf("Cluster was extended by %s by %s. Cluster will be kept until %s", extension, requester, keepUntilTime.Format(time.RFC3339)))
+	r.event(ctx, cluster, corev1.EventTypeNormal, messageExtended, keepUntilTime, now, messageFields{
+		Requester: requester,
+		Extension: extension,
+		Count:     count,
+		Total:     total,
+	})
+
+	return r.patchExtension(ctx, cluster, patch)
+}
+
+func (r *ClusterReconciler) patchExtension(ctx context.Context, cluster *capi.Cluster, patch ctrlclient.Patch) error {
+	if err := r.Patch(ctx, cluster, patch); err != nil {
+		return errors.Wrapf(err, "failed consuming %s annotation", extendByAnnotation)
+	}
+
+	return nil
+}
+
+// parseExtendBy parses the value of the extend-by annotation.
+func parseExtendBy(v string) (time.Duration, error) {
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to parse %s value %q", extendByAnnotation, v)
+	}
+	if d <= 0 {
+		return 0, errors.Errorf("%s value %q must be positive", extendByAnnotation, v)
+	}
+
+	return d, nil
+}
+
+func getExtensions(cluster *capi.Cluster) int {
+	count, err := strconv.Atoi(cluster.Annotations[extensionsAnnotation])
+	if err != nil {
+		return 0
+	}
+
+	return count
+}
+
+func getExtendedTotal(cluster *capi.Cluster) time.Duration {
+	total, err := time.ParseDuration(cluster.Annotations[extendedTotalAnnotation])
+	if err != nil {
+		return 0
+	}
+
+	return total
+}
@@ -0,0 +1,172 @@
+package controllers
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	testingclock "k8s.io/utils/clock/testing"
+	capi "sigs.k8s.io/cluster-api/api/core/v1beta2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/giantswarm/cluster-cleaner/pkg/policy"
+)
+
+func TestClusterExtension(t *testing.T) {
+	now := time.Date(2022, 2, 1, 12, 0, 0, 0, time.UTC)
+	created := now.Add(-1 * time.Hour)
+
+	testCases := []struct {
+		name               string
+		annotations        map[string]string
+		extendBy           string
+		budget             time.Duration
+		config             policy.Config
+		expectedEvent      string
+		expectedKeepUntil  time.Time
+		expectedExtensions string
+		expectedTotal      string
+		expectedRequester  string
+	}{
+		{
+			name:               "case 0 - first extension",
+			annotations:        map[string]string{},
+			extendBy:           "2h",
+			expectedEvent:      "Normal ClusterExtended",
+			expectedKeepUntil:  created.Add(defaultTTL + 2*time.Hour),
+			expectedExtensions: "1",
+			expectedTotal:      "2h0m0s",
+			expectedRequester:  "kubectl-annotate",
+		},
+		{
+			name: "case 1 - second extension",
+			annotations: map[string]string{
+				keepUntilAnnotation:     created.Add(8 * time.Hour).Format(time.RFC3339),
+				extensionsAnnotation:    "1",
+				extendedTotalAnnotation: "4h0m0s",
+			},
+			extendBy:           "1h",
+			budget:             5 * time.Hour,
+			expectedEvent:      "Normal ClusterExtended",
+			expectedKeepUntil:  created.Add(9 * time.Hour),
+			expectedExtensions: "2",
+			expectedTotal:      "5h0m0s",
+			expectedRequester:  "kubectl-annotate",
+		},
+		{
+			name: "case 2 - budget exhausted",
+			annotations: map[string]string{
+				extensionsAnnotation:    "1",
+				extendedTotalAnnotation: "2h0m0s",
+			},
+			extendBy:           "2h",
+			budget:             3 * time.Hour,
+			expectedEvent:      "Warning ExtensionRefused",
+			expectedExtensions: "1",
+			expectedTotal:      "2h0m0s",
+		},
+		{
+			name:          "case 3 - invalid extension",
+			annotations:   map[string]string{},
+			extendBy:      "two hours",
+			expectedEvent: "Warning ExtensionRefused",
+		},
+		{
+			name:          "case 4 - ignored cluster",
+			annotations:   map[string]string{ignoreClusterDeletion: "true"},
+			extendBy:      "2h",
+			expectedEvent: "Warning ExtensionRefused",
+		},
+		{
+			name:               "case 5 - requester recorded by the webhook",
+			annotations:        map[string]string{extendRequestedByAnnotation: "alice@example.com"},
+			extendBy:           "2h",
+			expectedEvent:      "Normal ClusterExtended",
+			expectedKeepUntil:  created.Add(defaultTTL + 2*time.Hour),
+			expectedExtensions: "1",
+			expectedTotal:      "2h0m0s",
+			expectedRequester:  "alice@example.com",
+		},
+		{
+			name:               "case 6 - extension clamped to the maximum keep-until horizon",
+			annotations:        map[string]string{},
+			extendBy:           "800h",
+			config:             policy.Config{MaxKeepUntilHorizon: 8 * time.Hour, MaxKeepUntilBasis: policy.KeepUntilBasisCreation},
+			expectedEvent:      "Warning KeepUntilClamped",
+			expectedKeepUntil:  created.Add(8 * time.Hour),
+			expectedExtensions: "1",
+			expectedTotal:      "4h0m0s",
+			expectedRequester:  "kubectl-annotate",
+		},
+		{
+			name:          "case 7 - maximum keep-until horizon reached",
+			annotations:   map[string]string{keepUntilAnnotation: created.Add(8 * time.Hour).Format(time.RFC3339)},
+			extendBy:      "2h",
+			config:        policy.Config{MaxKeepUntilHorizon: 8 * time.Hour, MaxKeepUntilBasis: policy.KeepUntilBasisCreation},
+			expectedEvent: "Warning ExtensionRefused",
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			cluster := newTestCluster("extended", "default", created, nil)
+			cluster.Annotations = tc.annotations
+			fakeClient := fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(cluster).WithReturnManagedFields().Build()
+			ctx := context.TODO()
+			key := types.NamespacedName{Name: cluster.GetName(), Namespace: cluster.GetNamespace()}
+
+			// request the extension like `kubectl annotate` does
+			obj := &capi.Cluster{}
+			if err := fakeClient.Get(ctx, key, obj); err != nil {
+				t.Fatal(err)
+			}
+			patch := ctrlclient.MergeFrom(obj.DeepCopy())
+			if obj.Annotations == nil {
+				obj.Annotations = map[string]string{}
+			}
+			obj.Annotations[extendByAnnotation] = tc.extendBy
+			if err := fakeClient.Patch(ctx, obj, patch, ctrlclient.FieldOwner("kubectl-annotate")); err != nil {
+				t.Fatal(err)
+			}
+
+			fakeRecorder := record.NewFakeRecorder(10)
+			r := &ClusterReconciler{
+				Client:   fakeClient,
+				Scheme:   fakeScheme,
+				Log:      ctrl.Log.WithName("fake"),
+				recorder: fakeRecorder,
+				Options:  Options{ExtensionBudget: tc.budget, Config: tc.config},
+				Clock:    testingclock.NewFakePassiveClock(now),
+			}
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			obj = &capi.Cluster{}
+			if err := fakeClient.Get(ctx, key, obj); err != nil {
+				t.Fatal(err)
+			}
+			assert.NotContains(t, obj.Annotations, extendByAnnotation, "test case %v failed.", tc.name)
+			assert.NotContains(t, obj.Annotations, extendRequestedByAnnotation, "test case %v failed.", tc.name)
+			assert.Equal(t, tc.expectedExtensions, obj.Annotations[extensionsAnnotation], "test case %v failed.", tc.name)
+			assert.Equal(t, tc.expectedTotal, obj.Annotations[extendedTotalAnnotation], "test case %v failed.", tc.name)
+
+			event := <-fakeRecorder.Events
+			assert.True(t, strings.HasPrefix(event, tc.expectedEvent), "test case %v failed. unexpected event %q", tc.name, event)
+
+			if tc.expectedKeepUntil.IsZero() {
+				return
+			}
+			assert.Equal(t, tc.expectedRequester, obj.Annotations[lastExtendedByAnnotation], "test case %v failed.", tc.name)
+			assert.Equal(t, tc.expectedKeepUntil.Format(time.RFC3339), obj.Annotations[keepUntilAnnotation], "test case %v failed.", tc.name)
+			assert.Equal(t, tc.expectedKeepUntil.Format(time.RFC3339), obj.Annotations[deleteAfterAnnotation], "test case %v failed.", tc.name)
+		})
+	}
+}
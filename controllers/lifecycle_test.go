@@ -0,0 +1,224 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	testingclock "k8s.io/utils/clock/testing"
+	capi "sigs.k8s.io/cluster-api/api/core/v1beta2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/giantswarm/cluster-cleaner/pkg/policy"
+)
+
+// lifecycle travels through the life of a single cluster with a fake clock. The cluster is reconciled whenever the
+// controller asks to be requeued, so the test sees exactly the reconciliations the controller schedules itself.
+type lifecycle struct {
+	t          *testing.T
+	created    time.Time
+	clock      *testingclock.FakeClock
+	client     ctrlclient.Client
+	recorder   *record.FakeRecorder
+	reconciler *ClusterReconciler
+	key        types.NamespacedName
+
+	// events are the reasons of all events sent, prefixed with the age of the cluster, e.g. `3h0m0s ClusterMarkedForDeletion`.
+	events []string
+}
+
+func newLifecycle(t *testing.T, cluster *capi.Cluster, o Options) *lifecycle {
+	created := cluster.CreationTimestamp.UTC()
+	clock := testingclock.NewFakeClock(created)
+	client := fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(cluster).Build()
+	recorder := record.NewFakeRecorder(100)
+
+	return &lifecycle{
+		t:        t,
+		created:  created,
+		clock:    clock,
+		client:   client,
+		recorder: recorder,
+		reconciler: &ClusterReconciler{
+			Client:   client,
+			Scheme:   fakeScheme,
+			Log:      ctrl.Log.WithName("fake"),
+			Options:  o,
+			Clock:    clock,
+			recorder: recorder,
+		},
+		key: types.NamespacedName{Name: cluster.Name, Namespace: cluster.Namespace},
+	}
+}
+
+// run reconciles the cluster until it is deleted or the controller stops requeueing it, but not beyond the given age.
+// It returns the age of the cluster at the last reconciliation.
+func (l *lifecycle) run(until time.Duration) time.Duration {
+	for {
+		result, err := l.reconciler.Reconcile(context.TODO(), ctrl.Request{NamespacedName: l.key})
+		if err != nil {
+			l.t.Fatal(err)
+		}
+		l.collectEvents()
+
+		if l.cluster().DeletionTimestamp != nil || result.RequeueAfter == 0 || l.age()+result.RequeueAfter > until {
+			return l.age()
+		}
+		l.clock.Step(result.RequeueAfter)
+	}
+}
+
+// travel moves the clock to the given age of the cluster.
+func (l *lifecycle) travel(age time.Duration) {
+	l.clock.SetTime(l.created.Add(age))
+}
+
+// annotate sets an annotation on the cluster like a user would do.
+func (l *lifecycle) annotate(key, value string) {
+	cluster := l.cluster()
+	patch := ctrlclient.MergeFrom(cluster.DeepCopy())
+	cluster.Annotations[key] = value
+	if err := l.client.Patch(context.TODO(), cluster, patch); err != nil {
+		l.t.Fatal(err)
+	}
+}
+
+func (l *lifecycle) cluster() *capi.Cluster {
+	cluster := &capi.Cluster{}
+	if err := l.client.Get(context.TODO(), l.key, cluster); err != nil {
+		l.t.Fatal(err)
+	}
+	if cluster.Annotations == nil {
+		cluster.Annotations = map[string]string{}
+	}
+
+	return cluster
+}
+
+func (l *lifecycle) age() time.Duration {
+	return l.clock.Since(l.created)
+}
+
+func (l *lifecycle) collectEvents() {
+	for {
+		select {
+		case event := <-l.recorder.Events:
+			// events are formatted as `<type> <reason> <message>`
+			reason := strings.Fields(event)[1]
+			l.events = append(l.events, fmt.Sprintf("%s %s", l.age(), reason))
+		default:
+			return
+		}
+	}
+}
+
+func TestClusterLifecycle(t *testing.T) {
+	created := time.Date(2022, 2, 1, 8, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name        string
+		annotations map[string]string
+		options     Options
+		// steps change the cluster at the given age, before it is reconciled again
+		steps            map[time.Duration]map[string]string
+		expectedEvents   []string
+		expectedDeletion time.Duration
+	}{
+		{
+			name: "case 0 - default ttl",
+			expectedEvents: []string{
+				"3h0m0s ClusterMarkedForDeletion",
+			},
+			expectedDeletion: defaultTTL,
+		},
+		{
+			name:    "case 1 - warning stages",
+			options: Options{Config: policy.Config{WarningStages: []time.Duration{24 * time.Hour, 15 * time.Minute}}},
+			expectedEvents: []string{
+				"0s ClusterMarkedForDeletion",
+				"3h0m0s ClusterMarkedForDeletion",
+				"3h45m0s ClusterMarkedForDeletion",
+			},
+			expectedDeletion: defaultTTL,
+		},
+		{
+			name:        "case 2 - keep-until",
+			annotations: map[string]string{keepUntilAnnotation: "2022-02-02T14:00:00Z"},
+			expectedEvents: []string{
+				"29h0m0s ClusterMarkedForDeletion",
+			},
+			expectedDeletion: 30 * time.Hour,
+		},
+		{
+			name:        "case 3 - ignore annotation expiry",
+			annotations: map[string]string{ignoreClusterDeletion: "10h"},
+			expectedEvents: []string{
+				"9h0m0s ClusterMarkedForDeletion",
+			},
+			expectedDeletion: 10 * time.Hour,
+		},
+		{
+			name: "case 4 - extended after the warning",
+			steps: map[time.Duration]map[string]string{
+				3*time.Hour + 30*time.Minute: {extendByAnnotation: "2h"},
+			},
+			expectedEvents: []string{
+				"3h0m0s ClusterMarkedForDeletion",
+				"3h30m0s ClusterExtended",
+				"5h0m0s ClusterMarkedForDeletion",
+			},
+			expectedDeletion: 6 * time.Hour,
+		},
+		{
+			name: "case 5 - deletion requested",
+			steps: map[time.Duration]map[string]string{
+				time.Hour: {deleteNowAnnotation: "true"},
+			},
+			expectedEvents: []string{
+				"1h0m0s ClusterDeletionRequested",
+			},
+			expectedDeletion: time.Hour,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			cluster := newTestCluster("lifecycle", "default", created, nil)
+			for k, v := range tc.annotations {
+				cluster.Annotations[k] = v
+			}
+			l := newLifecycle(t, cluster, tc.options)
+
+			for _, at := range sortedSteps(tc.steps) {
+				l.run(at)
+				l.travel(at)
+				for k, v := range tc.steps[at] {
+					l.annotate(k, v)
+				}
+			}
+			age := l.run(30 * 24 * time.Hour)
+
+			assert.Equal(t, tc.expectedEvents, l.events, "test case %v failed.", tc.name)
+			assert.NotNil(t, l.cluster().DeletionTimestamp, "test case %v failed. cluster was not deleted", tc.name)
+			assert.Equal(t, tc.expectedDeletion, age, "test case %v failed.", tc.name)
+		})
+	}
+}
+
+func sortedSteps(steps map[time.Duration]map[string]string) []time.Duration {
+	ages := make([]time.Duration, 0, len(steps))
+	for age := range steps {
+		ages = append(ages, age)
+	}
+	slices.Sort(ages)
+
+	return ages
+}
@@ -0,0 +1,232 @@
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+	capi "sigs.k8s.io/cluster-api/api/core/v1beta2"
+
+	"github.com/giantswarm/cluster-cleaner/pkg/policy"
+)
+
+// Messages are named like the reason of their event. Messages which are sent as notification only have a reason of
+// their own, too.
+const (
+	messageMarked            = "ClusterMarkedForDeletion"
+	messageDeleted           = "ClusterDeleted"
+	messageFailed            = "ClusterDeletionFailed"
+	messageIgnored           = "ClusterIgnored"
+	messageIgnoredTooLong    = "ClusterIgnoredTooLong"
+	messageDeletionRequested = "ClusterDeletionRequested"
+	messageExtended          = "ClusterExtended"
+	messageExtensionRefused  = "ExtensionRefused"
+	messageKeepUntilClamped  = "KeepUntilClamped"
+	messageInvalidKeepUntil  = "InvalidKeepUntil"
+)
+
+// Refusals of an extension, the Refusal of the ExtensionRefused message.
+const (
+	refusalInvalid   = "invalid"
+	refusalNotNeeded = "not-needed"
+	refusalHorizon   = "horizon"
+	refusalBudget    = "budget"
+)
+
+// defaultMessages are the templates of all messages.
+var defaultMessages = map[string]string{
+	messageMarked:            `Cluster will be deleted in aprox. {{ minutes .TimeLeft }} min.`,
+	messageDeleted:           `Cluster was deleted.`,
+	messageFailed:            `Deletion of the cluster failed: {{ .Error }}`,
+	messageIgnored:           `Cluster is ignored for deletion, {{ .Detail }}.`,
+	messageIgnoredTooLong:    `Cluster is ignored for deletion since {{ .IgnoredFor }}. Please remove annotation ` + ignoreClusterDeletion + ` or set an expiry if the cluster is no longer needed.`,
+	messageDeletionRequested: `Deletion of the cluster was requested by {{ .Requester }}.`,
+	messageExtended:          `Cluster was extended by {{ .Extension }} by {{ .Requester }} and will be kept until {{ rfc3339 .Deadline }}. Extension {{ .Count }}, {{ .Total }} in total.`,
+	messageExtensionRefused: `{{ if eq .Refusal "` + refusalInvalid + `" }}{{ .Error }}. Expected a duration like "2h".
+{{- else if eq .Refusal "` + refusalNotNeeded + `" }}Extension by {{ .Extension }} requested by {{ .Requester }} is not needed, the cluster is not going to be deleted.
+{{- else if eq .Refusal "` + refusalHorizon + `" }}Extension by {{ .Extension }} requested by {{ .Requester }} exceeds the maximum keep-until horizon of {{ .Horizon }} after the {{ .Basis }} basis.
+{{- else }}Extension by {{ .Extension }} requested by {{ .Requester }} exceeds the extension budget. Cluster has been extended by {{ .Total }} of {{ .Budget }} already.{{ end }}`,
+	messageKeepUntilClamped: `{{ if .Requester }}Extension requested by {{ .Requester }}{{ else }}Value of {{ .Source }}{{ end }} is more than {{ .Horizon }} after the {{ .Basis }} basis. Cluster will be kept until {{ rfc3339 .Deadline }} only.`,
+	messageInvalidKeepUntil: `{{ .Error }}. Expected label ` + keepUntil + ` as date like "` + keepUntilTimeLayout + `" or annotation ` + keepUntilAnnotation + ` as RFC3339 timestamp like "` + time.RFC3339 + `".`,
+}
+
+var messageFuncs = template.FuncMap{
+	"minutes": func(d time.Duration) int { return int(d.Minutes()) },
+	"hours":   func(d time.Duration) int { return int(d.Hours()) },
+	"rfc3339": func(t time.Time) string { return t.UTC().Format(time.RFC3339) },
+}
+
+// messageData is passed to the message templates.
+type messageData struct {
+	Cluster   string
+	Namespace string
+	// Owner is who created the cluster, empty if unknown.
+	Owner string
+	// Deadline is when the cluster is going to be deleted, zero if it is not going to be deleted. For
+	// ClusterExtended and KeepUntilClamped it is the new keep-until time.
+	Deadline time.Time
+	// TimeLeft is the time until the deadline.
+	TimeLeft time.Duration
+	// ExtendCommand extends the cluster by a day, users can adjust the duration.
+	ExtendCommand string
+
+	messageFields
+}
+
+// messageFields are the values of a message beyond the cluster and its deadline. Every message only sets the fields
+// it is about.
+type messageFields struct {
+	// Detail describes why the cluster is ignored.
+	Detail string
+	// Error is why the deletion failed, or why a keep-until or extend-by value is invalid.
+	Error string
+	// Requester is who requested the deletion or the extension.
+	Requester string
+	// Refusal is why an extension was refused: invalid, not-needed, horizon or budget.
+	Refusal string
+	// Extension is the requested extension, or the extension which was applied.
+	Extension time.Duration
+	// Count is the number of extensions of the cluster and Total their sum.
+	Count int
+	Total time.Duration
+	// Budget is the extension budget of a cluster.
+	Budget time.Duration
+	// Horizon is the maximum keep-until horizon after its Basis, creation or deadline.
+	Horizon time.Duration
+	Basis   policy.KeepUntilBasis
+	// Source is the label or annotation the keep-until value was taken from.
+	Source string
+	// IgnoredFor is how long the cluster has been ignored for deletion.
+	IgnoredFor time.Duration
+}
+
+// Messages renders the messages of events and notifications, so they read the same in Kubernetes events, Slack
+// and email. A nil Messages renders the default messages.
+type Messages struct {
+	templates map[string]*template.Template
+}
+
+// LoadMessages reads message templates overriding the default messages from a directory, e.g. a mounted ConfigMap.
+// Every file is a template named like the message. All templates are executed once, so mistakes are found at startup.
+func LoadMessages(dir string) (*Messages, error) {
+	overrides := map[string]string{}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed reading message templates from %s", dir)
+	}
+	for _, entry := range entries {
+		// skip the hidden files and directories of mounted ConfigMaps
+		if strings.HasPrefix(entry.Name(), ".") || entry.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed reading message template %s", entry.Name())
+		}
+		overrides[entry.Name()] = string(data)
+	}
+
+	return NewMessages(overrides)
+}
+
+// NewMessages returns Messages with the given templates overriding the default messages.
+func NewMessages(overrides map[string]string) (*Messages, error) {
+	m := &Messages{templates: map[string]*template.Template{}}
+	for name, text := range defaultMessages {
+		if override, ok := overrides[name]; ok {
+			text = strings.TrimSpace(override)
+		}
+		t, err := template.New(name).Funcs(messageFuncs).Parse(text)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid message template %s", name)
+		}
+		if err := t.Execute(&bytes.Buffer{}, sampleMessageData); err != nil {
+			return nil, errors.Wrapf(err, "invalid message template %s", name)
+		}
+		m.templates[name] = t
+	}
+
+	for name := range overrides {
+		if _, ok := defaultMessages[name]; !ok {
+			return nil, errors.Errorf("unknown message template %s, expected one of %s", name, strings.Join(messageNames(), ", "))
+		}
+	}
+
+	return m, nil
+}
+
+var sampleMessageData = messageData{
+	Cluster:       "sample",
+	Namespace:     "org-sample",
+	Owner:         "alice@example.com",
+	Deadline:      time.Date(2022, 2, 1, 12, 0, 0, 0, time.UTC),
+	TimeLeft:      time.Hour,
+	ExtendCommand: extendCommand("sample", "org-sample"),
+	messageFields: messageFields{
+		Detail:     "sample detail",
+		Error:      "sample error",
+		Requester:  "bob@example.com",
+		Refusal:    refusalBudget,
+		Extension:  24 * time.Hour,
+		Count:      2,
+		Total:      48 * time.Hour,
+		Budget:     72 * time.Hour,
+		Horizon:    30 * 24 * time.Hour,
+		Basis:      policy.KeepUntilBasisCreation,
+		Source:     keepUntilAnnotation,
+		IgnoredFor: 90 * 24 * time.Hour,
+	},
+}
+
+func messageNames() []string {
+	var names []string
+	for name := range defaultMessages {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	return names
+}
+
+// render renders the named message about the cluster. The deadline is zero if the cluster is not going to be deleted.
+// The default message is rendered if the template fails, so a message is never lost.
+func (m *Messages) render(name string, cluster *capi.Cluster, deadline, now time.Time, fields messageFields) string {
+	data := messageData{
+		Cluster:       cluster.Name,
+		Namespace:     cluster.Namespace,
+		Owner:         cluster.Annotations[ownerAnnotation],
+		Deadline:      deadline,
+		ExtendCommand: extendCommand(cluster.Name, cluster.Namespace),
+		messageFields: fields,
+	}
+	if !deadline.IsZero() {
+		data.TimeLeft = deadline.Sub(now)
+	}
+
+	if m != nil {
+		var out bytes.Buffer
+		if err := m.templates[name].Execute(&out, data); err == nil {
+			return out.String()
+		}
+	}
+
+	var out bytes.Buffer
+	_ = template.Must(template.New(name).Funcs(messageFuncs).Parse(defaultMessages[name])).Execute(&out, data)
+
+	return out.String()
+}
+
+func extendCommand(name, namespace string) string {
+	return fmt.Sprintf("kubectl annotate clusters.cluster.x-k8s.io -n %s %s %s=24h", namespace, name, extendByAnnotation)
+}
+
+// message renders the named message about the cluster.
+func (r *ClusterReconciler) message(name string, cluster *capi.Cluster, deadline, now time.Time, fields messageFields) string {
+	return r.Messages.render(name, cluster, deadline, now, fields)
+}
@@ -0,0 +1,238 @@
+package controllers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	testingclock "k8s.io/utils/clock/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/giantswarm/cluster-cleaner/pkg/policy"
+)
+
+func TestNewMessages(t *testing.T) {
+	now := time.Date(2022, 2, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name            string
+		overrides       map[string]string
+		expectedError   bool
+		expectedMessage string
+	}{
+		{
+			name:            "case 0 - default message",
+			expectedMessage: "Cluster will be deleted in aprox. 90 min.",
+		},
+		{
+			name: "case 1 - override",
+			overrides: map[string]string{
+				messageMarked: "{{ .Namespace }}/{{ .Cluster }} of {{ .Owner }} is deleted at {{ rfc3339 .Deadline }} ({{ hours .TimeLeft }}h). Run `{{ .ExtendCommand }}` to keep it.\n",
+			},
+			expectedMessage: "default/test of alice@example.com is deleted at 2022-02-01T13:30:00Z (1h). " +
+				"Run `kubectl annotate clusters.cluster.x-k8s.io -n default test cluster-cleaner.giantswarm.io/extend-by=24h` to keep it.",
+		},
+		{
+			name:          "case 2 - invalid template",
+			overrides:     map[string]string{messageMarked: "{{ .Cluster "},
+			expectedError: true,
+		},
+		{
+			name:          "case 3 - unknown field",
+			overrides:     map[string]string{messageMarked: "{{ .Name }}"},
+			expectedError: true,
+		},
+		{
+			name:          "case 4 - unknown message",
+			overrides:     map[string]string{"ClusterMarked": "{{ .Cluster }}"},
+			expectedError: true,
+		},
+		{
+			name:          "case 5 - unknown field of another message",
+			overrides:     map[string]string{messageExtended: "{{ .Extension }} of {{ .Allowance }}"},
+			expectedError: true,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			m, err := NewMessages(tc.overrides)
+			if tc.expectedError {
+				assert.Error(t, err, "test case %v failed.", tc.name)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cluster := newTestCluster("test", "default", now, nil)
+			cluster.Annotations = map[string]string{ownerAnnotation: "alice@example.com"}
+			message := m.render(messageMarked, cluster, now.Add(90*time.Minute), now, messageFields{})
+			assert.Equal(t, tc.expectedMessage, message, "test case %v failed.", tc.name)
+		})
+	}
+}
+
+func TestDefaultMessages(t *testing.T) {
+	now := time.Date(2022, 2, 1, 12, 0, 0, 0, time.UTC)
+	keepUntil := now.Add(48 * time.Hour)
+
+	testCases := []struct {
+		name            string
+		message         string
+		deadline        time.Time
+		fields          messageFields
+		expectedMessage string
+	}{
+		{
+			name:            "case 0 - deletion failed",
+			message:         messageFailed,
+			fields:          messageFields{Error: "app not found"},
+			expectedMessage: "Deletion of the cluster failed: app not found",
+		},
+		{
+			name:            "case 1 - deletion requested",
+			message:         messageDeletionRequested,
+			fields:          messageFields{Requester: "alice"},
+			expectedMessage: "Deletion of the cluster was requested by alice.",
+		},
+		{
+			name:            "case 2 - ignored too long",
+			message:         messageIgnoredTooLong,
+			fields:          messageFields{IgnoredFor: 720 * time.Hour},
+			expectedMessage: "Cluster is ignored for deletion since 720h0m0s. Please remove annotation alpha.giantswarm.io/ignore-cluster-deletion or set an expiry if the cluster is no longer needed.",
+		},
+		{
+			name:            "case 3 - extended",
+			message:         messageExtended,
+			deadline:        keepUntil,
+			fields:          messageFields{Requester: "alice", Extension: 24 * time.Hour, Count: 2, Total: 36 * time.Hour},
+			expectedMessage: "Cluster was extended by 24h0m0s by alice and will be kept until 2022-02-03T12:00:00Z. Extension 2, 36h0m0s in total.",
+		},
+		{
+			name:            "case 4 - invalid extension",
+			message:         messageExtensionRefused,
+			fields:          messageFields{Refusal: refusalInvalid, Requester: "alice", Error: `failed to parse value "x"`},
+			expectedMessage: `failed to parse value "x". Expected a duration like "2h".`,
+		},
+		{
+			name:            "case 5 - extension not needed",
+			message:         messageExtensionRefused,
+			fields:          messageFields{Refusal: refusalNotNeeded, Requester: "alice", Extension: time.Hour},
+			expectedMessage: "Extension by 1h0m0s requested by alice is not needed, the cluster is not going to be deleted.",
+		},
+		{
+			name:            "case 6 - extension beyond the horizon",
+			message:         messageExtensionRefused,
+			deadline:        keepUntil,
+			fields:          messageFields{Refusal: refusalHorizon, Requester: "alice", Extension: time.Hour, Horizon: 8 * time.Hour, Basis: policy.KeepUntilBasisCreation},
+			expectedMessage: "Extension by 1h0m0s requested by alice exceeds the maximum keep-until horizon of 8h0m0s after the creation basis.",
+		},
+		{
+			name:            "case 7 - extension beyond the budget",
+			message:         messageExtensionRefused,
+			deadline:        keepUntil,
+			fields:          messageFields{Refusal: refusalBudget, Requester: "alice", Extension: time.Hour, Count: 1, Total: 24 * time.Hour, Budget: 24 * time.Hour},
+			expectedMessage: "Extension by 1h0m0s requested by alice exceeds the extension budget. Cluster has been extended by 24h0m0s of 24h0m0s already.",
+		},
+		{
+			name:            "case 8 - extension clamped",
+			message:         messageKeepUntilClamped,
+			deadline:        keepUntil,
+			fields:          messageFields{Requester: "alice", Extension: time.Hour, Horizon: 8 * time.Hour, Basis: policy.KeepUntilBasisCreation},
+			expectedMessage: "Extension requested by alice is more than 8h0m0s after the creation basis. Cluster will be kept until 2022-02-03T12:00:00Z only.",
+		},
+		{
+			name:            "case 9 - keep-until clamped",
+			message:         messageKeepUntilClamped,
+			deadline:        keepUntil,
+			fields:          messageFields{Source: keepUntilAnnotation, Horizon: 8 * time.Hour, Basis: policy.KeepUntilBasisNow},
+			expectedMessage: "Value of cluster-cleaner.giantswarm.io/keep-until is more than 8h0m0s after the now basis. Cluster will be kept until 2022-02-03T12:00:00Z only.",
+		},
+		{
+			name:            "case 10 - invalid keep-until",
+			message:         messageInvalidKeepUntil,
+			fields:          messageFields{Error: `failed to parse value "x"`},
+			expectedMessage: `failed to parse value "x". Expected label keep-until as date like "2006-01-02" or annotation cluster-cleaner.giantswarm.io/keep-until as RFC3339 timestamp like "2006-01-02T15:04:05Z07:00".`,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			m, err := NewMessages(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cluster := newTestCluster("test", "default", now, nil)
+			message := m.render(tc.message, cluster, tc.deadline, now, tc.fields)
+			assert.Equal(t, tc.expectedMessage, message, "test case %v failed.", tc.name)
+		})
+	}
+}
+
+func TestLoadMessages(t *testing.T) {
+	// mounted ConfigMaps contain hidden files and directories next to the links to the keys
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "..data"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		messageDeleted:               "{{ .Cluster }} is gone.",
+		filepath.Join("..data", "x"): "{{ .Unknown }}",
+		".hidden":                    "{{ .Unknown }}",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := LoadMessages(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cluster := newTestCluster("test", "default", time.Now(), nil)
+	assert.Equal(t, "test is gone.", m.render(messageDeleted, cluster, time.Time{}, time.Now(), messageFields{}))
+	assert.Equal(t, "Cluster is ignored for deletion, it has label x.", m.render(messageIgnored, cluster, time.Time{}, time.Now(), messageFields{Detail: "it has label x"}))
+
+	_, err = LoadMessages(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+func TestMessagesRenderedConsistently(t *testing.T) {
+	now := time.Date(2022, 2, 1, 12, 0, 0, 0, time.UTC)
+	messages, err := NewMessages(map[string]string{messageMarked: "{{ .Cluster }} is deleted in {{ minutes .TimeLeft }} min."})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cluster := newTestCluster("test", "default", now.Add(-defaultTTL+time.Hour), nil)
+	notifier := &recordingNotifier{}
+	recorder := record.NewFakeRecorder(10)
+	r := &ClusterReconciler{
+		Client:   fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(cluster).Build(),
+		Scheme:   fakeScheme,
+		Log:      ctrl.Log.WithName("fake"),
+		Clock:    testingclock.NewFakePassiveClock(now),
+		Notifier: notifier,
+		Messages: messages,
+		recorder: recorder,
+	}
+
+	_, err = r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: types.NamespacedName{Name: cluster.Name, Namespace: cluster.Namespace}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !assert.Len(t, notifier.notifications, 1) {
+		return
+	}
+	assert.Equal(t, "test is deleted in 60 min.", notifier.notifications[0].Message)
+	assert.Equal(t, "Normal ClusterMarkedForDeletion test is deleted in 60 min.", <-recorder.Events)
+}
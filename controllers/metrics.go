@@ -1,8 +1,15 @@
 package controllers
 
 import (
+	"sync"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	capi "sigs.k8s.io/cluster-api/api/core/v1beta2"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/giantswarm/cluster-cleaner/pkg/policy"
 )
 
 const (
@@ -10,6 +17,20 @@ const (
 	metricSubsystem = "cluster"
 )
 
+// states of a cluster exposed by the State gauge
+const (
+	// stateIgnored clusters are not going to be deleted, or not before their ignore annotation expires.
+	stateIgnored = "ignored"
+	// stateProtected clusters are kept by a `keep-until` value in the future.
+	stateProtected = "protected"
+	// statePending clusters are going to be deleted, no warning was sent yet.
+	statePending = "pending"
+	// stateMarked clusters are marked for deletion, their first warning stage was reached.
+	stateMarked = "marked"
+	// stateDeleting clusters are being deleted.
+	stateDeleting = "deleting"
+)
+
 // Counters for cluster deletions
 var (
 	counterLabels = []string{"cluster_id", "cluster_namespace"}
@@ -52,7 +73,232 @@ var (
 	)
 )
 
+// Gauges for cluster state
+var (
+	InvalidKeepUntil = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricNamespace,
+			Subsystem: metricSubsystem,
+			Name:      "invalid_keep_until",
+			Help:      "Whether the cluster has a keep-until label or annotation which can not be parsed",
+		},
+		counterLabels,
+	)
+	IgnoredTooLong = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricNamespace,
+			Subsystem: metricSubsystem,
+			Name:      "ignored_too_long",
+			Help:      "Whether the cluster has been ignored for deletion for longer than the ignore warning threshold",
+		},
+		counterLabels,
+	)
+	// Owner has a single series per cluster, so the owner can be joined to the other metrics without adding it as
+	// label everywhere.
+	Owner = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricNamespace,
+			Subsystem: metricSubsystem,
+			Name:      "owner",
+			Help:      "Who created the cluster, always 1",
+		},
+		append(counterLabels, "owner"),
+	)
+	// SecondsUntilDeletion has a series for clusters which are pending deletion only.
+	SecondsUntilDeletion = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricNamespace,
+			Subsystem: metricSubsystem,
+			Name:      "seconds_until_deletion",
+			Help:      "Seconds until the cluster is deleted, negative once the deletion deadline has passed",
+		},
+		counterLabels,
+	)
+	// State has a single series per cluster with the current state in the state label.
+	State = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricNamespace,
+			Subsystem: metricSubsystem,
+			Name:      "state",
+			Help:      "Current state of the cluster, one of ignored, protected, pending, marked or deleting, always 1",
+		},
+		append(counterLabels, "state"),
+	)
+)
+
+// DecisionsTotal counts the decisions made for clusters by reason. It is not labelled by cluster, so it is kept
+// when clusters are gone.
+var DecisionsTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: metricNamespace,
+		Name:      "decisions_total",
+		Help:      "Number of decisions made for clusters by reason",
+	},
+	[]string{"reason"},
+)
+
+// Histograms for cluster deletions
+var (
+	AgeAtDeletion = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: metricNamespace,
+			Subsystem: metricSubsystem,
+			Name:      "age_at_deletion_seconds",
+			Help:      "Age of clusters when their deletion was started",
+			Buckets: []float64{
+				(1 * time.Hour).Seconds(), (2 * time.Hour).Seconds(), (4 * time.Hour).Seconds(), (8 * time.Hour).Seconds(),
+				(12 * time.Hour).Seconds(), (24 * time.Hour).Seconds(), (2 * 24 * time.Hour).Seconds(),
+				(3 * 24 * time.Hour).Seconds(), (7 * 24 * time.Hour).Seconds(), (14 * 24 * time.Hour).Seconds(),
+				(30 * 24 * time.Hour).Seconds(),
+			},
+		},
+	)
+	DeletionDelay = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: metricNamespace,
+			Subsystem: metricSubsystem,
+			Name:      "deletion_delay_seconds",
+			Help:      "Time between the deletion deadline of clusters and the start of their deletion",
+			Buckets:   []float64{1, 10, 30, 60, 2 * 60, 5 * 60, 10 * 60, 30 * 60, 60 * 60, 2 * 60 * 60},
+		},
+	)
+	DeletionDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: metricNamespace,
+			Subsystem: metricSubsystem,
+			Name:      "deletion_duration_seconds",
+			Help:      "Time from deleting the App CR, or the Cluster CR of vintage clusters, until the Cluster is gone",
+			Buckets:   []float64{30, 60, 2 * 60, 5 * 60, 10 * 60, 20 * 60, 30 * 60, 60 * 60, 2 * 60 * 60, 4 * 60 * 60},
+		},
+	)
+)
+
 func init() {
 	// Register custom metrics with the global prometheus registry
-	metrics.Registry.MustRegister(PendingTotal, ErrorsTotal, SuccessTotal, IgnoredTotal)
+	metrics.Registry.MustRegister(PendingTotal, ErrorsTotal, SuccessTotal, IgnoredTotal, InvalidKeepUntil, IgnoredTooLong, Owner,
+		SecondsUntilDeletion, State, AgeAtDeletion, DeletionDelay, DeletionDuration,
+		DecisionsTotal)
+}
+
+// clusterState returns the state of the cluster the decision puts it in.
+func clusterState(d policy.Decision) string {
+	switch {
+	case d.Reason == policy.DecisionDeleting:
+		return stateDeleting
+	case d.Reason == policy.DecisionKeepUntil:
+		return stateProtected
+	case d.Ignored() || d.Deadline.IsZero():
+		return stateIgnored
+	case d.Reason == policy.DecisionPending:
+		return statePending
+	}
+
+	return stateMarked
+}
+
+// setStateMetrics replaces the state series of the cluster and sets the time until its deletion. The time is removed
+// unless the cluster is pending deletion, i.e. protected, pending or marked, so e.g. an ignored cluster past its
+// deadline does not show up as overdue.
+func setStateMetrics(cluster *capi.Cluster, state string, deadline, now time.Time) {
+	State.DeletePartialMatch(prometheus.Labels{"cluster_id": cluster.Name, "cluster_namespace": cluster.Namespace})
+	State.WithLabelValues(cluster.Name, cluster.Namespace, state).Set(1)
+
+	pendingDeletion := state == stateProtected || state == statePending || state == stateMarked
+	if !pendingDeletion || deadline.IsZero() {
+		SecondsUntilDeletion.DeleteLabelValues(cluster.Name, cluster.Namespace)
+		return
+	}
+	SecondsUntilDeletion.WithLabelValues(cluster.Name, cluster.Namespace).Set(deadline.Sub(now).Seconds())
+}
+
+// deleteClusterMetrics removes the series of all gauges of a cluster which is gone.
+func deleteClusterMetrics(key types.NamespacedName) {
+	labels := prometheus.Labels{"cluster_id": key.Name, "cluster_namespace": key.Namespace}
+	for _, gauge := range []*prometheus.GaugeVec{InvalidKeepUntil, IgnoredTooLong, Owner, SecondsUntilDeletion, State} {
+		gauge.DeletePartialMatch(labels)
+	}
+}
+
+// deleteClusterCounters removes the series of all counters of a cluster.
+func deleteClusterCounters(key types.NamespacedName) {
+	for _, counter := range []*prometheus.CounterVec{IgnoredTotal, PendingTotal, ErrorsTotal, SuccessTotal} {
+		counter.DeleteLabelValues(key.Name, key.Namespace)
+	}
+}
+
+// counterSeries tracks the clusters which have counter series, so the series are deleted once a cluster is gone for
+// the retention period instead of being kept forever. It is kept in memory only like the counters themselves.
+type counterSeries struct {
+	mu sync.Mutex
+	// gone is when the cluster was found to be gone, zero while it exists
+	gone map[types.NamespacedName]time.Time
+}
+
+// seen records that the cluster exists.
+func (c *counterSeries) seen(key types.NamespacedName) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.gone == nil {
+		c.gone = map[types.NamespacedName]time.Time{}
+	}
+	c.gone[key] = time.Time{}
+}
+
+// retain records that the cluster is gone and returns how long its counter series are retained. Once the retention
+// period has passed, the series are deleted and false is returned. False is returned for unknown clusters as well.
+func (c *counterSeries) retain(key types.NamespacedName, now time.Time, retention time.Duration) (time.Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	gone, ok := c.gone[key]
+	if !ok {
+		return 0, false
+	}
+	if gone.IsZero() {
+		gone = now
+		c.gone[key] = gone
+	}
+
+	if left := gone.Add(retention).Sub(now); left > 0 {
+		return left, true
+	}
+	delete(c.gone, key)
+	deleteClusterCounters(key)
+
+	return 0, false
+}
+
+// deletionStarts remembers when the deletion of a cluster was started, so the time until the cluster is gone can be
+// observed. It is kept in memory only, so deletions started before a restart of the controller are not observed.
+type deletionStarts struct {
+	mu      sync.Mutex
+	started map[types.NamespacedName]time.Time
+}
+
+// start records the start of the deletion and returns whether it was not started before.
+func (d *deletionStarts) start(key types.NamespacedName, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.started[key]; ok {
+		return false
+	}
+	if d.started == nil {
+		d.started = map[types.NamespacedName]time.Time{}
+	}
+	d.started[key] = now
+
+	return true
+}
+
+// finish forgets the deletion and returns when it was started, or false if its start is unknown.
+func (d *deletionStarts) finish(key types.NamespacedName) (time.Time, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	started, ok := d.started[key]
+	delete(d.started, key)
+
+	return started, ok
 }
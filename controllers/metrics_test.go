@@ -0,0 +1,300 @@
+package controllers
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	gsapplication "github.com/giantswarm/apiextensions-application/api/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	testingclock "k8s.io/utils/clock/testing"
+	capi "sigs.k8s.io/cluster-api/api/core/v1beta2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/giantswarm/cluster-cleaner/pkg/policy"
+)
+
+func TestStateMetrics(t *testing.T) {
+	now := time.Date(2022, 2, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name                         string
+		cluster                      *capi.Cluster
+		expectedState                string
+		expectedSecondsUntilDeletion *float64
+	}{
+		{
+			name:                         "case 0 - pending",
+			cluster:                      newTestCluster("pending", "default", now.Add(-time.Hour), nil),
+			expectedState:                statePending,
+			expectedSecondsUntilDeletion: new(float64(3 * 60 * 60)),
+		},
+		{
+			name:                         "case 1 - marked",
+			cluster:                      newTestCluster("marked", "default", now.Add(30*time.Minute-defaultTTL), nil),
+			expectedState:                stateMarked,
+			expectedSecondsUntilDeletion: new(float64(30 * 60)),
+		},
+		{
+			name:          "case 2 - ignored",
+			cluster:       newTestCluster("ignored", "default", now, map[string]string{fluxLabel: "flux"}),
+			expectedState: stateIgnored,
+		},
+		{
+			name: "case 3 - protected",
+			cluster: func() *capi.Cluster {
+				cluster := newTestCluster("protected", "default", now.Add(-defaultTTL), nil)
+				cluster.Annotations[keepUntilAnnotation] = now.Add(48 * time.Hour).Format(time.RFC3339)
+				return cluster
+			}(),
+			expectedState:                stateProtected,
+			expectedSecondsUntilDeletion: new(float64(48 * 60 * 60)),
+		},
+		{
+			name:          "case 4 - deleted",
+			cluster:       newTestCluster("deleted", "default", now.Add(-defaultTTL), nil),
+			expectedState: stateDeleting,
+		},
+		{
+			name:          "case 5 - too old",
+			cluster:       newTestCluster("too-old", "default", now.Add(-policy.DefaultMaxAge-time.Hour), nil),
+			expectedState: stateIgnored,
+		},
+		{
+			name: "case 6 - ignored until a date past the deadline",
+			cluster: func() *capi.Cluster {
+				cluster := newTestCluster("ignored-until", "default", now.Add(-defaultTTL-time.Hour), nil)
+				cluster.Annotations[ignoreClusterDeletion] = now.Add(24 * time.Hour).Format(time.RFC3339)
+				return cluster
+			}(),
+			expectedState: stateIgnored,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			r := &ClusterReconciler{
+				Client:   fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(tc.cluster).Build(),
+				Scheme:   fakeScheme,
+				Log:      ctrl.Log.WithName("fake"),
+				Clock:    testingclock.NewFakePassiveClock(now),
+				recorder: record.NewFakeRecorder(10),
+			}
+			req := ctrl.Request{NamespacedName: ctrlKey(tc.cluster)}
+			if _, err := r.Reconcile(context.TODO(), req); err != nil {
+				t.Fatal(err)
+			}
+
+			labels := prometheus.Labels{"cluster_id": tc.cluster.Name, "cluster_namespace": tc.cluster.Namespace}
+			assert.Equal(t, map[string]float64{tc.expectedState: 1}, gaugeSeries(t, State, labels, "state"), "test case %v failed.", tc.name)
+			seconds := gaugeSeries(t, SecondsUntilDeletion, labels, "")
+			if tc.expectedSecondsUntilDeletion == nil {
+				assert.Empty(t, seconds, "test case %v failed.", tc.name)
+			} else {
+				assert.Equal(t, map[string]float64{"": *tc.expectedSecondsUntilDeletion}, seconds, "test case %v failed.", tc.name)
+			}
+
+			// the series are removed once the cluster is gone
+			r.Client = fake.NewClientBuilder().WithScheme(fakeScheme).Build()
+			if _, err := r.Reconcile(context.TODO(), req); err != nil {
+				t.Fatal(err)
+			}
+			assert.Empty(t, gaugeSeries(t, State, labels, "state"), "test case %v failed.", tc.name)
+			assert.Empty(t, gaugeSeries(t, SecondsUntilDeletion, labels, ""), "test case %v failed.", tc.name)
+			assert.Empty(t, gaugeSeries(t, Owner, labels, "owner"), "test case %v failed.", tc.name)
+		})
+	}
+}
+
+// gaugeSeries returns the values of the series of the gauge matching the labels by the value of the key label.
+func gaugeSeries(t *testing.T, gauge *prometheus.GaugeVec, labels prometheus.Labels, key string) map[string]float64 {
+	ch := make(chan prometheus.Metric, 100)
+	gauge.Collect(ch)
+	close(ch)
+
+	series := map[string]float64{}
+	for metric := range ch {
+		m := &dto.Metric{}
+		if err := metric.Write(m); err != nil {
+			t.Fatal(err)
+		}
+		values := map[string]string{}
+		for _, pair := range m.GetLabel() {
+			values[pair.GetName()] = pair.GetValue()
+		}
+		matches := true
+		for name, value := range labels {
+			matches = matches && values[name] == value
+		}
+		if matches {
+			series[values[key]] = m.GetGauge().GetValue()
+		}
+	}
+
+	return series
+}
+
+func TestCounterSeriesRetention(t *testing.T) {
+	now := time.Date(2022, 2, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name      string
+		retention time.Duration
+	}{
+		{
+			name:      "case 0 - retained",
+			retention: time.Hour,
+		},
+		{
+			name: "case 1 - deleted right away",
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			cluster := newTestCluster("retained", "default", now, map[string]string{fluxLabel: "flux"})
+			clock := testingclock.NewFakePassiveClock(now)
+			r := &ClusterReconciler{
+				Client:           fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(cluster).Build(),
+				Scheme:           fakeScheme,
+				Log:              ctrl.Log.WithName("fake"),
+				Clock:            clock,
+				MetricsRetention: tc.retention,
+				recorder:         record.NewFakeRecorder(10),
+			}
+			req := ctrl.Request{NamespacedName: ctrlKey(cluster)}
+			if _, err := r.Reconcile(context.TODO(), req); err != nil {
+				t.Fatal(err)
+			}
+			before := counterSeriesCount(t)
+			assert.Equal(t, 1, counterSeriesCount(t, cluster.Name), "test case %v failed.", tc.name)
+
+			// the cluster is gone
+			r.Client = fake.NewClientBuilder().WithScheme(fakeScheme).Build()
+			result, err := r.Reconcile(context.TODO(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tc.retention > 0 {
+				assert.Equal(t, tc.retention, result.RequeueAfter, "test case %v failed.", tc.name)
+				assert.Equal(t, before, counterSeriesCount(t), "test case %v failed.", tc.name)
+
+				clock.SetTime(now.Add(tc.retention))
+				result, err = r.Reconcile(context.TODO(), req)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			assert.Zero(t, result.RequeueAfter, "test case %v failed.", tc.name)
+			assert.Equal(t, before-1, counterSeriesCount(t), "test case %v failed.", tc.name)
+			assert.Zero(t, counterSeriesCount(t, cluster.Name), "test case %v failed.", tc.name)
+		})
+	}
+}
+
+// counterSeriesCount returns the number of series of the counters in the registry, of the given clusters only if any.
+func counterSeriesCount(t *testing.T, clusters ...string) int {
+	families, err := metrics.Registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var count int
+	for _, family := range families {
+		if family.GetType() != dto.MetricType_COUNTER || !strings.HasPrefix(family.GetName(), metricNamespace+"_"+metricSubsystem+"_") {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			for _, pair := range m.GetLabel() {
+				if pair.GetName() == "cluster_id" && (len(clusters) == 0 || slices.Contains(clusters, pair.GetValue())) {
+					count++
+				}
+			}
+		}
+	}
+
+	return count
+}
+
+func TestDeletionHistograms(t *testing.T) {
+	now := time.Date(2022, 2, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name    string
+		vintage bool
+	}{
+		{
+			name: "case 0 - CAPI-based cluster",
+		},
+		{
+			name:    "case 1 - vintage cluster",
+			vintage: true,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			cluster := newTestCluster("histograms", "default", now.Add(-defaultTTL-5*time.Minute), nil)
+			if !tc.vintage {
+				delete(cluster.Labels, clusterOperatorVersion)
+				cluster.Annotations[helmReleaseNameAnnotation] = "histograms"
+				cluster.Annotations[helmReleaseNamespaceAnnotation] = "default"
+			}
+			app := &gsapplication.App{ObjectMeta: metav1.ObjectMeta{Name: "histograms", Namespace: "default"}}
+			clock := testingclock.NewFakePassiveClock(now)
+			r := &ClusterReconciler{
+				Client:   fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(cluster, app).Build(),
+				Scheme:   fakeScheme,
+				Log:      ctrl.Log.WithName("fake"),
+				Clock:    clock,
+				recorder: record.NewFakeRecorder(10),
+			}
+			ageCount, ageSum := histogramSamples(t, AgeAtDeletion)
+			delayCount, delaySum := histogramSamples(t, DeletionDelay)
+			durationCount, durationSum := histogramSamples(t, DeletionDuration)
+
+			// the deletion is observed once only
+			req := ctrl.Request{NamespacedName: ctrlKey(cluster)}
+			for range 2 {
+				if _, err := r.Reconcile(context.TODO(), req); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// the cluster is gone
+			clock.SetTime(now.Add(10 * time.Minute))
+			r.Client = fake.NewClientBuilder().WithScheme(fakeScheme).Build()
+			if _, err := r.Reconcile(context.TODO(), req); err != nil {
+				t.Fatal(err)
+			}
+
+			count, sum := histogramSamples(t, AgeAtDeletion)
+			assert.Equal(t, ageCount+1, count, "test case %v failed.", tc.name)
+			assert.Equal(t, ageSum+(defaultTTL+5*time.Minute).Seconds(), sum, "test case %v failed.", tc.name)
+			count, sum = histogramSamples(t, DeletionDelay)
+			assert.Equal(t, delayCount+1, count, "test case %v failed.", tc.name)
+			assert.Equal(t, delaySum+(5*time.Minute).Seconds(), sum, "test case %v failed.", tc.name)
+			count, sum = histogramSamples(t, DeletionDuration)
+			assert.Equal(t, durationCount+1, count, "test case %v failed.", tc.name)
+			assert.Equal(t, durationSum+(10*time.Minute).Seconds(), sum, "test case %v failed.", tc.name)
+		})
+	}
+}
+
+// histogramSamples returns the number and the sum of all observations of the histogram.
+func histogramSamples(t *testing.T, histogram prometheus.Histogram) (uint64, float64) {
+	m := &dto.Metric{}
+	if err := histogram.Write(m); err != nil {
+		t.Fatal(err)
+	}
+
+	return m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum()
+}
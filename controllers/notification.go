@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/giantswarm/k8smetadata/pkg/label"
+	"k8s.io/apimachinery/pkg/types"
+	capi "sigs.k8s.io/cluster-api/api/core/v1beta2"
+
+	"github.com/giantswarm/cluster-cleaner/pkg/notification"
+)
+
+// reasons why a cluster is ignored for deletion, sent with ignored notifications
+const (
+	ignoredReasonFlux              = "flux"
+	ignoredReasonAnnotation        = "annotation"
+	ignoredReasonPolicy            = "policy"
+	ignoredReasonInvalidKeepUntil  = "invalid-keep-until"
+	ignoredReasonMaxAge            = "max-age"
+	ignoredReasonNoChartAnnotation = "no-chart-annotation"
+	ignoredReasonNoApp             = "no-app"
+)
+
+// notificationStates remembers the last ignored and failed notification per cluster, so they are sent once when the
+// state of a cluster changes instead of on every reconciliation. It is kept in memory only, so the notifications are
+// sent again after a restart of the controller.
+type notificationStates struct {
+	mu     sync.Mutex
+	states map[types.NamespacedName]map[notification.Kind]string
+}
+
+// changed records the state and returns whether it differs from the last recorded state.
+func (s *notificationStates) changed(key types.NamespacedName, kind notification.Kind, state string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.states == nil {
+		s.states = map[types.NamespacedName]map[notification.Kind]string{}
+	}
+	if s.states[key] == nil {
+		s.states[key] = map[notification.Kind]string{}
+	}
+	if last, ok := s.states[key][kind]; ok && last == state {
+		return false
+	}
+	s.states[key][kind] = state
+
+	return true
+}
+
+// get returns the recorded state of the kind, or false if none is recorded.
+func (s *notificationStates) get(key types.NamespacedName, kind notification.Kind) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.states[key][kind]
+
+	return state, ok
+}
+
+// recorded returns the recorded states of the kind by cluster.
+func (s *notificationStates) recorded(kind notification.Kind) map[types.NamespacedName]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	recorded := map[types.NamespacedName]string{}
+	for key, states := range s.states {
+		if state, ok := states[kind]; ok {
+			recorded[key] = state
+		}
+	}
+
+	return recorded
+}
+
+// forget removes the recorded state of the given kinds, or all kinds if none are given.
+func (s *notificationStates) forget(key types.NamespacedName, kinds ...notification.Kind) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(kinds) == 0 {
+		delete(s.states, key)
+		return
+	}
+	for _, kind := range kinds {
+		delete(s.states[key], kind)
+	}
+}
+
+// newNotification returns a notification of the given kind about the cluster, addressed to its owner. The email
+// address of the owner defaults to the creator of the cluster if it is an email address.
+func newNotification(cluster *capi.Cluster, kind notification.Kind, message string, now time.Time) notification.Notification {
+	owner := cluster.Annotations[ownerAnnotation]
+	email := cluster.Annotations[ownerEmailAnnotation]
+	if email == "" {
+		email = ownerEmail(owner)
+	}
+
+	return notification.Notification{
+		Kind:         kind,
+		Cluster:      cluster.Name,
+		Namespace:    cluster.Namespace,
+		Owner:        owner,
+		OwnerEmail:   email,
+		Organization: cluster.Labels[label.Organization],
+		Message:      message,
+		Time:         now,
+	}
+}
+
+func (r *ClusterReconciler) notify(n notification.Notification) {
+	if r.Notifier != nil && !r.DryRun {
+		r.Notifier.Notify(n)
+	}
+}
+
+// notifyIgnored notifies that the cluster is ignored for deletion, unless it was already ignored with the same detail.
+// The detail completes the ClusterIgnored message, e.g. "it has label X".
+func (r *ClusterReconciler) notifyIgnored(cluster *capi.Cluster, reason string, deadline time.Time, detail string, now time.Time) {
+	if !r.notified.changed(ctrlKey(cluster), notification.KindIgnored, detail) {
+		return
+	}
+
+	n := newNotification(cluster, notification.KindIgnored, r.message(messageIgnored, cluster, deadline, now, messageFields{Detail: detail}), now)
+	n.Deadline = deadline
+	n.Reason = reason
+	r.notify(n)
+}
+
+// notifyFailed notifies that the deletion of the cluster failed, unless it already failed before without succeeding
+// in between. The last error is recorded for the digest.
+func (r *ClusterReconciler) notifyFailed(cluster *capi.Cluster, err error, now time.Time) {
+	_, failedBefore := r.notified.get(ctrlKey(cluster), notification.KindFailed)
+	r.notified.changed(ctrlKey(cluster), notification.KindFailed, err.Error())
+	if failedBefore {
+		return
+	}
+
+	r.notify(newNotification(cluster, notification.KindFailed, r.message(messageFailed, cluster, time.Time{}, now, messageFields{Error: err.Error()}), now))
+}
+
+func ctrlKey(cluster *capi.Cluster) types.NamespacedName {
+	return types.NamespacedName{Name: cluster.Name, Namespace: cluster.Namespace}
+}
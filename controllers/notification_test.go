@@ -0,0 +1,250 @@
+package controllers
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	gsapplication "github.com/giantswarm/apiextensions-application/api/v1alpha1"
+	"github.com/giantswarm/k8smetadata/pkg/label"
+	"github.com/pkg/errors"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	testingclock "k8s.io/utils/clock/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	"github.com/giantswarm/cluster-cleaner/pkg/notification"
+)
+
+// recordingNotifier records all notifications instead of sending them.
+type recordingNotifier struct {
+	notifications []notification.Notification
+}
+
+func (n *recordingNotifier) Notify(notification notification.Notification) {
+	n.notifications = append(n.notifications, notification)
+}
+
+func TestNotifications(t *testing.T) {
+	now := time.Date(2022, 2, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name                  string
+		age                   time.Duration
+		dryRun                bool
+		expectedNotifications []notification.Notification
+	}{
+		{
+			name: "case 0 - not marked yet",
+			age:  time.Hour,
+		},
+		{
+			name: "case 1 - marked for deletion",
+			age:  defaultTTL - time.Hour,
+			expectedNotifications: []notification.Notification{
+				{
+					Kind:      notification.KindMarked,
+					Cluster:   "test",
+					Namespace: "default",
+					Deadline:  now.Add(time.Hour),
+					Message:   "Cluster will be deleted in aprox. 60 min.",
+					Time:      now,
+				},
+			},
+		},
+		{
+			name: "case 2 - deleted",
+			age:  defaultTTL,
+			expectedNotifications: []notification.Notification{
+				{
+					Kind:      notification.KindDeleted,
+					Cluster:   "test",
+					Namespace: "default",
+					Message:   "Cluster was deleted.",
+					Time:      now,
+				},
+			},
+		},
+		{
+			name:   "case 3 - dry run",
+			age:    defaultTTL,
+			dryRun: true,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			cluster := newTestCluster("test", "default", now.Add(-tc.age), nil)
+			cluster.Annotations = map[string]string{
+				helmReleaseNameAnnotation:      "test",
+				helmReleaseNamespaceAnnotation: "default",
+			}
+			app := &gsapplication.App{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "default",
+				},
+			}
+			fakeClient := fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(cluster, app).Build()
+			notifier := &recordingNotifier{}
+			r := &ClusterReconciler{
+				Client:   fakeClient,
+				Scheme:   fakeScheme,
+				Log:      ctrl.Log.WithName("fake"),
+				DryRun:   tc.dryRun,
+				Clock:    testingclock.NewFakePassiveClock(now),
+				Notifier: notifier,
+				recorder: record.NewFakeRecorder(10),
+			}
+
+			_, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: types.NamespacedName{Name: cluster.Name, Namespace: cluster.Namespace}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, tc.expectedNotifications, notifier.notifications, "test case %v failed.", tc.name)
+		})
+	}
+}
+
+func TestNotificationsSentOnce(t *testing.T) {
+	now := time.Date(2022, 2, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name          string
+		labels        map[string]string
+		failDeletion  bool
+		expectedKinds []notification.Kind
+	}{
+		{
+			name:          "case 0 - ignored",
+			labels:        map[string]string{fluxLabel: "flux"},
+			expectedKinds: []notification.Kind{notification.KindIgnored},
+		},
+		{
+			name:          "case 1 - failed",
+			failDeletion:  true,
+			expectedKinds: []notification.Kind{notification.KindFailed},
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			cluster := newTestCluster("test", "default", now.Add(-defaultTTL), tc.labels)
+			cluster.Annotations = map[string]string{
+				helmReleaseNameAnnotation:      "test",
+				helmReleaseNamespaceAnnotation: "default",
+			}
+			app := &gsapplication.App{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "default",
+				},
+			}
+			builder := fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(cluster, app)
+			if tc.failDeletion {
+				builder = builder.WithInterceptorFuncs(interceptor.Funcs{
+					Delete: func(ctx context.Context, client ctrlclient.WithWatch, obj ctrlclient.Object, opts ...ctrlclient.DeleteOption) error {
+						return errors.New("deletion failed")
+					},
+				})
+			}
+			notifier := &recordingNotifier{}
+			r := &ClusterReconciler{
+				Client:   builder.Build(),
+				Scheme:   fakeScheme,
+				Log:      ctrl.Log.WithName("fake"),
+				Clock:    testingclock.NewFakePassiveClock(now),
+				Notifier: notifier,
+				recorder: record.NewFakeRecorder(10),
+			}
+
+			// the state of the cluster does not change between the reconciliations, so it is notified only once
+			for range 3 {
+				_, _ = r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: types.NamespacedName{Name: cluster.Name, Namespace: cluster.Namespace}})
+			}
+
+			var kinds []notification.Kind
+			for _, n := range notifier.notifications {
+				kinds = append(kinds, n.Kind)
+			}
+			assert.Equal(t, tc.expectedKinds, kinds, "test case %v failed.", tc.name)
+		})
+	}
+}
+
+func TestAppDeletionNotifiedOnce(t *testing.T) {
+	now := time.Date(2022, 2, 1, 12, 0, 0, 0, time.UTC)
+	cluster := newTestCluster("kept-app", "default", now.Add(-defaultTTL), nil)
+	delete(cluster.Labels, clusterOperatorVersion)
+	cluster.Annotations = map[string]string{
+		helmReleaseNameAnnotation:      "kept-app",
+		helmReleaseNamespaceAnnotation: "default",
+	}
+	// the App CRs are kept by their finalizers until the cluster is gone
+	app := &gsapplication.App{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "kept-app",
+			Namespace:  "default",
+			Finalizers: []string{"test.giantswarm.io/keep"},
+		},
+	}
+	defaultApp := &gsapplication.App{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "kept-app-default-apps",
+			Namespace:  "default",
+			Finalizers: []string{"test.giantswarm.io/keep"},
+		},
+	}
+	notifier := &recordingNotifier{}
+	r := &ClusterReconciler{
+		Client:   fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(cluster, app, defaultApp).Build(),
+		Scheme:   fakeScheme,
+		Log:      ctrl.Log.WithName("fake"),
+		Clock:    testingclock.NewFakePassiveClock(now),
+		Notifier: notifier,
+		recorder: record.NewFakeRecorder(10),
+	}
+
+	// the counters are global, remove the series so the test can be repeated
+	t.Cleanup(func() { deleteClusterCounters(ctrlKey(cluster)) })
+
+	for range 3 {
+		if _, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: ctrlKey(cluster)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var kinds []notification.Kind
+	for _, n := range notifier.notifications {
+		kinds = append(kinds, n.Kind)
+	}
+	assert.Equal(t, []notification.Kind{notification.KindDeleted}, kinds)
+
+	m := &dto.Metric{}
+	if err := SuccessTotal.WithLabelValues(cluster.Name, cluster.Namespace).Write(m); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, float64(1), m.GetCounter().GetValue())
+}
+
+func TestNewNotification(t *testing.T) {
+	now := time.Date(2022, 2, 1, 12, 0, 0, 0, time.UTC)
+	cluster := newTestCluster("test", "org-acme", now, map[string]string{label.Organization: "acme"})
+	cluster.Annotations = map[string]string{ownerEmailAnnotation: "alice@example.com"}
+
+	assert.Equal(t, notification.Notification{
+		Kind:         notification.KindDeleted,
+		Cluster:      "test",
+		Namespace:    "org-acme",
+		OwnerEmail:   "alice@example.com",
+		Organization: "acme",
+		Message:      "Cluster was deleted.",
+		Time:         now,
+	}, newNotification(cluster, notification.KindDeleted, "Cluster was deleted.", now))
+}
@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"context"
+	"net/mail"
+
+	gsapplication "github.com/giantswarm/apiextensions-application/api/v1alpha1"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	capi "sigs.k8s.io/cluster-api/api/core/v1beta2"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/giantswarm/cluster-cleaner/pkg/policy"
+)
+
+// clusterOwner returns who created the cluster. In order of precedence it is
+//   - the owner annotation, once the owner has been determined,
+//   - the creator annotation of the cluster or its App CR,
+//   - the field manager which created the App CR of the cluster, as the Cluster CR itself is created by helm,
+//   - the field manager which created the cluster.
+//
+// It returns an empty string if the owner can not be determined.
+func clusterOwner(ctx context.Context, client ctrlclient.Client, cluster *capi.Cluster) (string, error) {
+	if owner := cluster.Annotations[ownerAnnotation]; owner != "" {
+		return owner, nil
+	}
+	if creator := cluster.Annotations[creatorAnnotation]; creator != "" {
+		return creator, nil
+	}
+
+	if policy.HasChartAnnotations(cluster) {
+		app := &gsapplication.App{}
+		err := client.Get(ctx, getClusterAppNamespacedName(cluster), app)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return "", errors.Wrap(err, "failed getting cluster App CR")
+		}
+		if err == nil {
+			if creator := app.Annotations[creatorAnnotation]; creator != "" {
+				return creator, nil
+			}
+			if manager := creationManager(app.ManagedFields); manager != "" {
+				return manager, nil
+			}
+		}
+	}
+
+	return creationManager(cluster.ManagedFields), nil
+}
+
+// creationManager returns the field manager which most likely created the object: the manager of the oldest
+// managedFields entry. Entries are updated when their manager changes the object again, so it is a best guess.
+func creationManager(entries []metav1.ManagedFieldsEntry) string {
+	var manager string
+	var oldest *metav1.Time
+	for _, entry := range entries {
+		if entry.Manager == "" || entry.Subresource != "" {
+			continue
+		}
+		if manager == "" || (entry.Time != nil && (oldest == nil || entry.Time.Before(oldest))) {
+			manager = entry.Manager
+			oldest = entry.Time
+		}
+	}
+
+	return manager
+}
+
+// ownerEmail returns the owner as email address if it is one, e.g. for users authenticated with OIDC.
+func ownerEmail(owner string) string {
+	if address, err := mail.ParseAddress(owner); err == nil {
+		return address.Address
+	}
+
+	return ""
+}
+
+// setOwnerMetric replaces the owner series of the cluster.
+func setOwnerMetric(cluster *capi.Cluster, owner string) {
+	Owner.DeletePartialMatch(prometheus.Labels{"cluster_id": cluster.Name, "cluster_namespace": cluster.Namespace})
+	Owner.WithLabelValues(cluster.Name, cluster.Namespace, owner).Set(1)
+}
+
+// updateOwnerAnnotation stores the owner of the cluster in the owner annotation, so it is determined once only and
+// stays known after the App CR is gone. The owner is returned, even in dry run mode.
+func (r *ClusterReconciler) updateOwnerAnnotation(ctx context.Context, cluster *capi.Cluster) (string, error) {
+	owner, err := clusterOwner(ctx, r.Client, cluster)
+	if err != nil {
+		return "", err
+	}
+	if owner == "" || cluster.Annotations[ownerAnnotation] == owner || r.DryRun {
+		return owner, nil
+	}
+
+	patch := ctrlclient.MergeFrom(cluster.DeepCopy())
+	if cluster.Annotations == nil {
+		cluster.Annotations = map[string]string{}
+	}
+	cluster.Annotations[ownerAnnotation] = owner
+	if err := r.Patch(ctx, cluster, patch); err != nil {
+		return "", errors.Wrapf(err, "failed updating %s annotation", ownerAnnotation)
+	}
+
+	return owner, nil
+}
@@ -0,0 +1,202 @@
+package controllers
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	gsapplication "github.com/giantswarm/apiextensions-application/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	testingclock "k8s.io/utils/clock/testing"
+	capi "sigs.k8s.io/cluster-api/api/core/v1beta2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/giantswarm/cluster-cleaner/pkg/notification"
+)
+
+func managedFields(managers map[string]time.Time) []metav1.ManagedFieldsEntry {
+	var entries []metav1.ManagedFieldsEntry
+	for manager, at := range managers {
+		entries = append(entries, metav1.ManagedFieldsEntry{
+			Manager:    manager,
+			Operation:  metav1.ManagedFieldsOperationUpdate,
+			APIVersion: "v1",
+			Time:       &metav1.Time{Time: at},
+			FieldsType: "FieldsV1",
+			FieldsV1:   &metav1.FieldsV1{Raw: []byte(`{"f:metadata":{"f:labels":{}}}`)},
+		})
+	}
+
+	return entries
+}
+
+func TestClusterOwner(t *testing.T) {
+	created := time.Date(2022, 2, 1, 8, 0, 0, 0, time.UTC)
+	chart := map[string]string{
+		helmReleaseNameAnnotation:      "test",
+		helmReleaseNamespaceAnnotation: "default",
+	}
+
+	testCases := []struct {
+		name                string
+		annotations         map[string]string
+		managers            map[string]time.Time
+		app                 bool
+		appAnnotations      map[string]string
+		appManagers         map[string]time.Time
+		expectedOwner       string
+		expectedOwnerStored bool
+	}{
+		{
+			name:          "case 0 - unknown",
+			expectedOwner: "",
+		},
+		{
+			name:                "case 1 - owner annotation",
+			annotations:         map[string]string{ownerAnnotation: "alice@example.com", creatorAnnotation: "bob@example.com"},
+			expectedOwner:       "alice@example.com",
+			expectedOwnerStored: true,
+		},
+		{
+			name:                "case 2 - creator annotation",
+			annotations:         map[string]string{creatorAnnotation: "bob@example.com"},
+			managers:            map[string]time.Time{"kubectl-create": created},
+			expectedOwner:       "bob@example.com",
+			expectedOwnerStored: true,
+		},
+		{
+			name:                "case 3 - oldest cluster manager",
+			managers:            map[string]time.Time{"kubectl-annotate": created.Add(time.Hour), "kubectl-create": created},
+			expectedOwner:       "kubectl-create",
+			expectedOwnerStored: true,
+		},
+		{
+			name:                "case 4 - app creator annotation",
+			annotations:         chart,
+			managers:            map[string]time.Time{"helm": created},
+			app:                 true,
+			appAnnotations:      map[string]string{creatorAnnotation: "carol@example.com"},
+			appManagers:         map[string]time.Time{"kubectl-gs": created},
+			expectedOwner:       "carol@example.com",
+			expectedOwnerStored: true,
+		},
+		{
+			name:                "case 5 - oldest app manager",
+			annotations:         chart,
+			managers:            map[string]time.Time{"helm": created},
+			app:                 true,
+			appManagers:         map[string]time.Time{"kubectl-gs": created, "app-operator": created.Add(time.Minute)},
+			expectedOwner:       "kubectl-gs",
+			expectedOwnerStored: true,
+		},
+		{
+			name:                "case 6 - app is gone",
+			annotations:         chart,
+			managers:            map[string]time.Time{"helm": created},
+			expectedOwner:       "helm",
+			expectedOwnerStored: true,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			cluster := newTestCluster("test", "default", created, nil)
+			cluster.Annotations = map[string]string{}
+			for k, v := range tc.annotations {
+				cluster.Annotations[k] = v
+			}
+			cluster.ManagedFields = managedFields(tc.managers)
+			objects := []ctrlclient.Object{cluster}
+			if tc.app {
+				objects = append(objects, &gsapplication.App{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:          "test",
+						Namespace:     "default",
+						Annotations:   tc.appAnnotations,
+						ManagedFields: managedFields(tc.appManagers),
+					},
+				})
+			}
+			fakeClient := fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(objects...).WithReturnManagedFields().Build()
+			r := &ClusterReconciler{
+				Client: fakeClient,
+				Scheme: fakeScheme,
+				Log:    ctrl.Log.WithName("fake"),
+			}
+
+			owner, err := r.updateOwnerAnnotation(context.TODO(), cluster)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.expectedOwner, owner, "test case %v failed.", tc.name)
+
+			stored := &capi.Cluster{}
+			if err := fakeClient.Get(context.TODO(), types.NamespacedName{Name: cluster.Name, Namespace: cluster.Namespace}, stored); err != nil {
+				t.Fatal(err)
+			}
+			storedOwner, found := stored.Annotations[ownerAnnotation]
+			assert.Equal(t, tc.expectedOwnerStored, found, "test case %v failed.", tc.name)
+			assert.Equal(t, tc.expectedOwner, storedOwner, "test case %v failed.", tc.name)
+		})
+	}
+}
+
+func TestOwnerIsDefaultRecipient(t *testing.T) {
+	now := time.Date(2022, 2, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name          string
+		annotations   map[string]string
+		expectedEmail string
+	}{
+		{
+			name:          "case 0 - owner with email address",
+			annotations:   map[string]string{creatorAnnotation: "alice@example.com"},
+			expectedEmail: "alice@example.com",
+		},
+		{
+			name:          "case 1 - owner email annotation takes precedence",
+			annotations:   map[string]string{creatorAnnotation: "alice@example.com", ownerEmailAnnotation: "team@example.com"},
+			expectedEmail: "team@example.com",
+		},
+		{
+			name:          "case 2 - owner without email address",
+			annotations:   map[string]string{creatorAnnotation: "kubectl-create"},
+			expectedEmail: "",
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			cluster := newTestCluster("test", "default", now.Add(-defaultTTL), nil)
+			cluster.Annotations = tc.annotations
+			notifier := &recordingNotifier{}
+			r := &ClusterReconciler{
+				Client:   fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(cluster).Build(),
+				Scheme:   fakeScheme,
+				Log:      ctrl.Log.WithName("fake"),
+				Clock:    testingclock.NewFakePassiveClock(now),
+				Notifier: notifier,
+				recorder: record.NewFakeRecorder(10),
+			}
+
+			_, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: types.NamespacedName{Name: cluster.Name, Namespace: cluster.Namespace}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !assert.Len(t, notifier.notifications, 1, "test case %v failed.", tc.name) {
+				return
+			}
+			n := notifier.notifications[0]
+			assert.Equal(t, notification.KindDeleted, n.Kind, "test case %v failed.", tc.name)
+			assert.Equal(t, tc.annotations[creatorAnnotation], n.Owner, "test case %v failed.", tc.name)
+			assert.Equal(t, tc.expectedEmail, n.OwnerEmail, "test case %v failed.", tc.name)
+			assert.Equal(t, 1.0, gaugeValue(t, Owner, cluster.Name, cluster.Namespace, n.Owner), "test case %v failed.", tc.name)
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package controllers
+
+import (
+	"time"
+
+	capi "sigs.k8s.io/cluster-api/api/core/v1beta2"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/giantswarm/cluster-cleaner/pkg/policy"
+)
+
+// nextReconcile returns the next instant after now at which the state of the cluster changes without any change
+// to the cluster itself: a warning stage is reached or the deletion deadline passes. It returns false if there is
+// no such instant, e.g. because the cluster is not going to be deleted or its deadline has already passed.
+func nextReconcile(cluster *capi.Cluster, s policy.Settings, o Options, now time.Time) (time.Time, bool) {
+	deadline, ok := policy.Deadline(cluster, s, o.Config, now)
+	if !ok || !deadline.After(now) {
+		return time.Time{}, false
+	}
+
+	next := deadline
+	for _, stage := range policy.WarningStages(s, o.Config) {
+		if at := deadline.Add(-stage); at.After(now) && at.Before(next) {
+			next = at
+		}
+	}
+
+	return next, true
+}
+
+// scheduledRequeue requeues the cluster at its next reconcile instant, or not at all if there is none.
+func scheduledRequeue(cluster *capi.Cluster, s policy.Settings, o Options, now time.Time) ctrl.Result {
+	next, ok := nextReconcile(cluster, s, o, now)
+	if !ok {
+		return ctrl.Result{}
+	}
+
+	return ctrl.Result{RequeueAfter: next.Sub(now)}
+}
@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	testingclock "k8s.io/utils/clock/testing"
+
+	"github.com/giantswarm/cluster-cleaner/pkg/policy"
+)
+
+func TestNextReconcile(t *testing.T) {
+	created := time.Date(2022, 2, 1, 8, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name         string
+		annotations  map[string]string
+		options      Options
+		elapsed      time.Duration
+		expectedNext time.Time
+		expectedOK   bool
+	}{
+		{
+			name:         "case 0 - warning lead time",
+			elapsed:      0,
+			expectedNext: created.Add(defaultTTL - defaultWarningLeadTime),
+			expectedOK:   true,
+		},
+		{
+			name:         "case 1 - deadline after last warning stage",
+			elapsed:      defaultTTL - 30*time.Minute,
+			expectedNext: created.Add(defaultTTL),
+			expectedOK:   true,
+		},
+		{
+			name:       "case 2 - deadline passed",
+			elapsed:    defaultTTL + time.Minute,
+			expectedOK: false,
+		},
+		{
+			name:         "case 3 - warning stages",
+			options:      Options{Config: policy.Config{WarningStages: []time.Duration{24 * time.Hour, 15 * time.Minute}}},
+			elapsed:      defaultTTL - 50*time.Minute,
+			expectedNext: created.Add(defaultTTL - 15*time.Minute),
+			expectedOK:   true,
+		},
+		{
+			name:         "case 4 - keep-until",
+			annotations:  map[string]string{keepUntilAnnotation: "2022-02-03T08:00:00Z"},
+			elapsed:      time.Hour,
+			expectedNext: created.Add(47 * time.Hour),
+			expectedOK:   true,
+		},
+		{
+			name:         "case 5 - ignore annotation expiry",
+			annotations:  map[string]string{ignoreClusterDeletion: "10h"},
+			elapsed:      time.Hour,
+			expectedNext: created.Add(9 * time.Hour),
+			expectedOK:   true,
+		},
+		{
+			name:        "case 6 - ignored",
+			annotations: map[string]string{ignoreClusterDeletion: "true"},
+			elapsed:     time.Hour,
+			expectedOK:  false,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			clock := testingclock.NewFakePassiveClock(created.Add(tc.elapsed))
+			cluster := newTestCluster("scheduled", "default", created, nil)
+			cluster.Annotations = tc.annotations
+
+			next, ok := nextReconcile(cluster, policy.DefaultSettings(), tc.options, clock.Now())
+			assert.Equal(t, tc.expectedOK, ok, "test case %v failed.", tc.name)
+			assert.True(t, tc.expectedNext.Equal(next), "test case %v failed. expected %v, got %v", tc.name, tc.expectedNext, next)
+		})
+	}
+}
+
+func TestScheduleThroughLifecycle(t *testing.T) {
+	created := time.Date(2022, 2, 1, 8, 0, 0, 0, time.UTC)
+	clock := testingclock.NewFakeClock(created)
+	cluster := newTestCluster("scheduled", "default", created, nil)
+	o := Options{Config: policy.Config{WarningStages: []time.Duration{24 * time.Hour, 15 * time.Minute}}}
+
+	var schedule []time.Duration
+	for {
+		result := scheduledRequeue(cluster, policy.DefaultSettings(), o, clock.Now())
+		if result.RequeueAfter == 0 {
+			break
+		}
+		clock.Step(result.RequeueAfter)
+		schedule = append(schedule, clock.Since(created))
+	}
+
+	// the cluster is only reconciled when a warning stage is reached and when it is due for deletion
+	assert.Equal(t, []time.Duration{3 * time.Hour, 3*time.Hour + 45*time.Minute, defaultTTL}, schedule)
+}
@@ -1,66 +1,146 @@
 package controllers
 
 import (
+	"context"
 	"fmt"
+	"strings"
 	"time"
 
+	gsapplication "github.com/giantswarm/apiextensions-application/api/v1alpha1"
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/utils/clock"
 	capi "sigs.k8s.io/cluster-api/api/core/v1beta2"
-	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/giantswarm/cluster-cleaner/pkg/policy"
 )
 
 const (
-	ignoreClusterDeletion = "alpha.giantswarm.io/ignore-cluster-deletion"
-	keepUntil             = "keep-until"
-
-	// defaultTTL is the default time to live for a cluster.
-	defaultTTL = 4 * time.Hour
+	// labels, annotations and defaults of the cleanup rules
+	ignoreClusterDeletion       = policy.IgnoreAnnotation
+	keepUntil                   = policy.KeepUntilLabel
+	keepUntilAnnotation         = policy.KeepUntilAnnotation
+	keepUntilTimezoneAnnotation = policy.KeepUntilTimezoneAnnotation
+	keepUntilObservedAnnotation = policy.KeepUntilObservedAnnotation
+	deleteNowAnnotation         = policy.DeleteNowAnnotation
+	deleteRequestedByAnnotation = policy.DeleteRequestedByAnnotation
+	clusterTTL                  = policy.ClusterTTL
+	keepUntilTimeLayout         = policy.KeepUntilLabelLayout
+	fluxLabel                   = policy.FluxLabel
+	clusterOperatorVersion      = policy.ClusterOperatorVersionLabel
+
+	helmReleaseNameAnnotation      = policy.HelmReleaseNameAnnotation
+	helmReleaseNamespaceAnnotation = policy.HelmReleaseNamespaceAnnotation
+
+	defaultTTL             = policy.DefaultTTL
+	defaultWarningLeadTime = policy.DefaultWarningLeadTime
+	defaultMaxAge          = policy.DefaultMaxAge
 
 	// eventDefaultTTL is the default time when we sent a `ClusterMarkedForDeletion` event.
-	eventDefaultTTL = defaultTTL - 1*time.Hour
+	eventDefaultTTL = defaultTTL - defaultWarningLeadTime
+
+	// deleteAfterAnnotation is the annotation showing when the cluster will be deleted as RFC3339 timestamp.
+	// It is set by the mutating webhook on creation and kept up to date by the reconciler.
+	deleteAfterAnnotation = "cluster-cleaner.giantswarm.io/delete-after"
+
+	// extendByAnnotation extends the deletion deadline of the cluster by a duration, e.g. `2h`. It is consumed and
+	// removed by the reconciler.
+	extendByAnnotation = "cluster-cleaner.giantswarm.io/extend-by"
+
+	// extensionsAnnotation is the number of extensions applied to the cluster.
+	extensionsAnnotation = "cluster-cleaner.giantswarm.io/extensions"
+
+	// extendedTotalAnnotation is the sum of all extensions applied to the cluster, e.g. `6h0m0s`.
+	extendedTotalAnnotation = "cluster-cleaner.giantswarm.io/extended-total"
 
-	// keepUntilTimeLayout is the layout for the `keep-until` label.
-	keepUntilTimeLayout = "2006-01-02"
+	// extendRequestedByAnnotation is the user who set the extend-by annotation. It is set by the mutating webhook and
+	// consumed together with the extend-by annotation.
+	extendRequestedByAnnotation = "cluster-cleaner.giantswarm.io/extend-requested-by"
 
-	// helmReleaseNameAnnotation is the annotation containing the chart release name
-	helmReleaseNameAnnotation = "meta.helm.sh/release-name"
+	// lastExtendedByAnnotation is who requested the last extension of the cluster, the user if it was recorded by the
+	// mutating webhook and the field manager otherwise.
+	lastExtendedByAnnotation = "cluster-cleaner.giantswarm.io/last-extended-by"
 
-	// helmReleaseNamespaceAnnotation is the annotation containing the chart release namespace
-	helmReleaseNamespaceAnnotation = "meta.helm.sh/release-namespace"
+	// warningsSentAnnotation records the warning stages a `ClusterMarkedForDeletion` event was sent for as
+	// `<deletion deadline>/<stage>,<stage>`, e.g. `2022-02-01T16:00:00Z/24h0m0s,1h0m0s`.
+	warningsSentAnnotation = "cluster-cleaner.giantswarm.io/warnings-sent"
 
-	// fluxLabel is the label for checking if the cluster is created via git-ops
-	fluxLabel = "kustomize.toolkit.fluxcd.io/name"
+	// ownerAnnotation is who created the cluster, e.g. `alice@example.com`. It is set by the mutating webhook on creation
+	// or determined by the reconciler, and the default recipient of notifications.
+	ownerAnnotation = "cluster-cleaner.giantswarm.io/owner"
 
-	clusterOperatorVersion = "cluster-operator.giantswarm.io/version"
+	// creatorAnnotation is who created the cluster, set by tooling creating clusters on behalf of users. It is
+	// read from the cluster and its App CR.
+	creatorAnnotation = "giantswarm.io/creator"
+
+	// ownerEmailAnnotation is the email address of the owner of the cluster, who is notified about its deletion.
+	ownerEmailAnnotation = "giantswarm.io/owner-email"
 )
 
-func requeue() reconcile.Result {
-	return ctrl.Result{
-		RequeueAfter: time.Minute * 5,
-	}
+// bookkeepingAnnotations are the annotations in which the controller tracks the limits and extensions of a cluster,
+// and who requested them. Only the controller may change them, see ClusterValidator.
+var bookkeepingAnnotations = []string{
+	keepUntilObservedAnnotation,
+	extendRequestedByAnnotation,
+	deleteRequestedByAnnotation,
+	extensionsAnnotation,
+	extendedTotalAnnotation,
+	lastExtendedByAnnotation,
 }
 
-func getClusterCreationTimeStamp(cluster *capi.Cluster) time.Time {
-	return cluster.CreationTimestamp.UTC()
-}
+// invalidKeepUntilRequeue is the interval in which clusters ignored because of an invalid `keep-until` value are re-evaluated.
+const invalidKeepUntilRequeue = 1 * time.Hour
 
-func deletionTimeReached(cluster *capi.Cluster) bool {
-	return time.Now().UTC().After(getClusterCreationTimeStamp(cluster).Add(defaultTTL))
+// Options are the controller wide cleanup options shared by the reconciler and the webhooks.
+type Options struct {
+	// Config configures the rules deciding whether and when clusters are deleted.
+	policy.Config
+
+	// IgnoreWarningThreshold is the age after which ignored clusters are reported. Zero disables the warning.
+	IgnoreWarningThreshold time.Duration
+
+	// ExtensionBudget is the sum of all extensions a cluster may get with the extend-by annotation. Zero disables the limit.
+	ExtensionBudget time.Duration
 }
 
-func deletionTime(cluster *capi.Cluster) int {
-	return int(defaultTTL.Minutes()) - int(time.Now().UTC().Sub(getClusterCreationTimeStamp(cluster)).Minutes())
+// ParseWarningStages returns the warning stages for the given comma separated flag value, e.g. `24h,1h,15m`.
+func ParseWarningStages(v string) ([]time.Duration, error) {
+	var stages []time.Duration
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		stage, err := time.ParseDuration(item)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid warning stage %q", item)
+		}
+		if stage <= 0 {
+			return nil, errors.Errorf("invalid warning stage %q, must be positive", item)
+		}
+		stages = append(stages, stage)
+	}
+
+	return stages, nil
 }
 
-func deletionEventTimeReached(cluster *capi.Cluster) bool {
-	return time.Now().UTC().After(getClusterCreationTimeStamp(cluster).Add(eventDefaultTTL))
+// ParseDigestTime returns the time of day since midnight for the given flag value in UTC, e.g. `08:00`.
+func ParseDigestTime(v string) (time.Duration, error) {
+	t, err := time.Parse("15:04", v)
+	if err != nil {
+		return 0, errors.Errorf("invalid digest time %q, expected a time of day like %q", v, "08:00")
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
 }
 
-func hasChartAnnotations(cluster *capi.Cluster) bool {
-	releaseName, nameOK := cluster.Annotations[helmReleaseNameAnnotation]
-	releaseNamespace, namespaceOK := cluster.Annotations[helmReleaseNamespaceAnnotation]
-	return nameOK && namespaceOK && releaseName != "" && releaseNamespace != ""
+// currentTime returns the current time of the clock, or the real time if no clock is set.
+func currentTime(c clock.PassiveClock) time.Time {
+	if c == nil {
+		return time.Now().UTC()
+	}
+
+	return c.Now().UTC()
 }
 
 func getClusterAppNamespacedName(cluster *capi.Cluster) client.ObjectKey {
@@ -70,6 +150,24 @@ func getClusterAppNamespacedName(cluster *capi.Cluster) client.ObjectKey {
 	}
 }
 
+// getClusterApp returns the App CR named in the chart annotations of the cluster, or nil if the cluster has no chart
+// annotations or the App CR does not exist.
+func getClusterApp(ctx context.Context, c client.Client, cluster *capi.Cluster) (*gsapplication.App, error) {
+	if !policy.HasChartAnnotations(cluster) {
+		return nil, nil
+	}
+
+	app := &gsapplication.App{}
+	if err := c.Get(ctx, getClusterAppNamespacedName(cluster), app); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed getting cluster App CR")
+	}
+
+	return app, nil
+}
+
 func getDefaultAppNamespacedName(cluster *capi.Cluster) client.ObjectKey {
 	return client.ObjectKey{
 		Name:      fmt.Sprintf("%s-default-apps", cluster.Name),
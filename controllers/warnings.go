@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	capi "sigs.k8s.io/cluster-api/api/core/v1beta2"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/giantswarm/cluster-cleaner/pkg/notification"
+)
+
+// sendWarnings sends a `ClusterMarkedForDeletion` event once per warning stage reached before the deletion deadline.
+// Stages reached at the same time, e.g. after a downtime of the controller, are reported with a single event.
+func (r *ClusterReconciler) sendWarnings(ctx context.Context, log logr.Logger, cluster *capi.Cluster, deadline time.Time, stages []time.Duration, now time.Time) error {
+	sent := getWarningsSent(cluster, deadline)
+
+	var reached []time.Duration
+	for _, stage := range stages {
+		if now.Before(deadline.Add(-stage)) {
+			continue
+		}
+		if !slices.Contains(sent, stage) {
+			reached = append(reached, stage)
+		}
+	}
+	if len(reached) == 0 {
+		return nil
+	}
+
+	if r.DryRun {
+		log.Info("DryRun: skipping sending deletion event for cluster")
+		return nil
+	}
+
+	log.Info(fmt.Sprintf("Cluster is marked for deletion, warning stage %s reached", reached[len(reached)-1]))
+	message := r.event(ctx, cluster, corev1.EventTypeNormal, messageMarked, deadline, now, messageFields{})
+	n := newNotification(cluster, notification.KindMarked, message, now)
+	n.Deadline = deadline
+	r.notify(n)
+
+	patch := ctrlclient.MergeFrom(cluster.DeepCopy())
+	if cluster.Annotations == nil {
+		cluster.Annotations = map[string]string{}
+	}
+	cluster.Annotations[warningsSentAnnotation] = formatWarningsSent(deadline, append(sent, reached...))
+	if err := r.Patch(ctx, cluster, patch); err != nil {
+		return errors.Wrapf(err, "failed updating %s annotation", warningsSentAnnotation)
+	}
+
+	return nil
+}
+
+// getWarningsSent returns the warning stages a `ClusterMarkedForDeletion` event was sent for. Stages sent for
+// another deadline, e.g. before the cluster was extended, are not returned.
+func getWarningsSent(cluster *capi.Cluster, deadline time.Time) []time.Duration {
+	sentDeadline, values, ok := strings.Cut(cluster.Annotations[warningsSentAnnotation], "/")
+	if !ok || sentDeadline != deadline.UTC().Format(time.RFC3339) {
+		return nil
+	}
+
+	var sent []time.Duration
+	for _, v := range strings.Split(values, ",") {
+		if stage, err := time.ParseDuration(v); err == nil {
+			sent = append(sent, stage)
+		}
+	}
+
+	return sent
+}
+
+func formatWarningsSent(deadline time.Time, stages []time.Duration) string {
+	values := make([]string, 0, len(stages))
+	for _, stage := range stages {
+		values = append(values, stage.String())
+	}
+
+	return fmt.Sprintf("%s/%s", deadline.UTC().Format(time.RFC3339), strings.Join(values, ","))
+}
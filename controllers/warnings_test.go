@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	testingclock "k8s.io/utils/clock/testing"
+	capi "sigs.k8s.io/cluster-api/api/core/v1beta2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/giantswarm/cluster-cleaner/pkg/policy"
+)
+
+func TestWarningStages(t *testing.T) {
+	now := time.Date(2022, 2, 1, 12, 0, 0, 0, time.UTC)
+	created := now.Add(-defaultTTL + 30*time.Minute)
+	deadline := created.Add(defaultTTL)
+
+	testCases := []struct {
+		name                 string
+		annotations          map[string]string
+		expectedEvents       int
+		expectedWarningsSent string
+	}{
+		{
+			name:                 "case 0 - stages reached at once are sent with one event",
+			annotations:          map[string]string{},
+			expectedEvents:       1,
+			expectedWarningsSent: deadline.Format(time.RFC3339) + "/24h0m0s,1h0m0s",
+		},
+		{
+			name: "case 1 - stages are sent only once",
+			annotations: map[string]string{
+				warningsSentAnnotation: deadline.Format(time.RFC3339) + "/24h0m0s,1h0m0s",
+			},
+			expectedEvents:       0,
+			expectedWarningsSent: deadline.Format(time.RFC3339) + "/24h0m0s,1h0m0s",
+		},
+		{
+			name: "case 2 - missing stage is sent",
+			annotations: map[string]string{
+				warningsSentAnnotation: deadline.Format(time.RFC3339) + "/24h0m0s",
+			},
+			expectedEvents:       1,
+			expectedWarningsSent: deadline.Format(time.RFC3339) + "/24h0m0s,1h0m0s",
+		},
+		{
+			name: "case 3 - stages are sent again for a new deadline",
+			annotations: map[string]string{
+				warningsSentAnnotation: deadline.Add(-time.Hour).Format(time.RFC3339) + "/24h0m0s,1h0m0s",
+			},
+			expectedEvents:       1,
+			expectedWarningsSent: deadline.Format(time.RFC3339) + "/24h0m0s,1h0m0s",
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			cluster := newTestCluster("warned", "default", created, nil)
+			cluster.Annotations = tc.annotations
+			fakeClient := fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(cluster).Build()
+			fakeRecorder := record.NewFakeRecorder(10)
+			r := &ClusterReconciler{
+				Client:   fakeClient,
+				Scheme:   fakeScheme,
+				Log:      ctrl.Log.WithName("fake"),
+				recorder: fakeRecorder,
+				Options: Options{
+					Config: policy.Config{WarningStages: []time.Duration{24 * time.Hour, 28 * time.Minute}},
+				},
+				Clock: testingclock.NewFakePassiveClock(now),
+			}
+			ctx := context.TODO()
+			key := types.NamespacedName{Name: cluster.Name, Namespace: cluster.Namespace}
+			result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the next reconciliation is scheduled for the 28m stage
+			assert.Equal(t, deadline.Add(-28*time.Minute).Sub(now), result.RequeueAfter, "test case %v failed.", tc.name)
+			assert.Equal(t, tc.expectedEvents, len(fakeRecorder.Events), "test case %v failed.", tc.name)
+
+			obj := &capi.Cluster{}
+			if err := fakeClient.Get(ctx, key, obj); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.expectedWarningsSent, obj.Annotations[warningsSentAnnotation], "test case %v failed.", tc.name)
+		})
+	}
+}
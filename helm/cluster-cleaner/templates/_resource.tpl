@@ -14,6 +14,18 @@ room for such suffix.
 {{- include "resource.default.name" . -}}-network-policy
 {{- end -}}
 
+{{- define "resource.webhook.name" -}}
+{{- include "resource.default.name" . -}}-webhook
+{{- end -}}
+
+{{- define "resource.notifications.name" -}}
+{{- include "resource.default.name" . -}}-notifications
+{{- end -}}
+
+{{- define "resource.messages.name" -}}
+{{- include "resource.default.name" . -}}-messages
+{{- end -}}
+
 {{- define "resource.psp.name" -}}
 {{- include "resource.default.name" . -}}-psp
 {{- end -}}
@@ -16,12 +16,17 @@ package main
 import (
 	"flag"
 	"os"
+	"strings"
+	"time"
+	// Embed the IANA time zone database for `keep-until` time zones.
+	_ "time/tzdata"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
 	gsapplication "github.com/giantswarm/apiextensions-application/api/v1alpha1"
+	"github.com/pkg/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
@@ -32,7 +37,10 @@ import (
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
+	cleanerv1alpha1 "github.com/giantswarm/cluster-cleaner/api/v1alpha1"
 	"github.com/giantswarm/cluster-cleaner/controllers"
+	"github.com/giantswarm/cluster-cleaner/pkg/notification"
+	"github.com/giantswarm/cluster-cleaner/pkg/policy"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -45,6 +53,7 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	_ = capi.AddToScheme(scheme)
 	_ = gsapplication.AddToScheme(scheme)
+	utilruntime.Must(cleanerv1alpha1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
@@ -52,9 +61,42 @@ func main() {
 	var metricsAddr string
 	var probeAddr string
 	var dryRun bool
+	var invalidKeepUntilBehaviour string
+	var webhookEnabled bool
+	var maxKeepUntilHorizon time.Duration
+	var maxKeepUntilBasis string
+	var ignoreAllowedUsers string
+	var ignoreAllowedGroups string
+	var controllerUsername string
+	var maxIgnorePeriod time.Duration
+	var ignoreWarningThreshold time.Duration
+	var extensionBudget time.Duration
+	var warningStages string
+	var notificationConfig string
+	var messagesDir string
+	var digestTime string
+	var eventDeduplicationWindow time.Duration
+	var metricsRetention time.Duration
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&dryRun, "dry-run", false, "Enable dry-run.")
+	flag.StringVar(&invalidKeepUntilBehaviour, "invalid-keep-until-behaviour", string(policy.InvalidKeepUntilIgnore),
+		"How to treat clusters with a keep-until value which can not be parsed: absent, ignore or delete.")
+	flag.DurationVar(&maxIgnorePeriod, "max-ignore-period", 0, "How long after their creation clusters may be ignored for deletion with the ignore annotation. Zero disables the limit.")
+	flag.DurationVar(&ignoreWarningThreshold, "ignore-warning-threshold", 0, "Age after which ignored clusters are reported with a warning event and metric. Zero disables the warning.")
+	flag.BoolVar(&webhookEnabled, "webhook-enabled", false, "Enable the admission webhooks for clusters.")
+	flag.DurationVar(&maxKeepUntilHorizon, "max-keep-until-horizon", 0, "How far after the basis a keep-until value may point. Later values are rejected by the webhook and clamped by the controller. Zero disables the limit.")
+	flag.StringVar(&maxKeepUntilBasis, "max-keep-until-basis", string(policy.KeepUntilBasisNow), "From when the max keep-until horizon is counted: now (when the value was set) or creation.")
+	flag.StringVar(&ignoreAllowedUsers, "ignore-allowed-users", "", "Comma separated list of users allowed to set the ignore annotation. Everybody is allowed if no users or groups are set.")
+	flag.StringVar(&ignoreAllowedGroups, "ignore-allowed-groups", "", "Comma separated list of groups allowed to set the ignore annotation. Everybody is allowed if no users or groups are set.")
+	flag.StringVar(&controllerUsername, "controller-username", "", "User of the controller, e.g. system:serviceaccount:giantswarm:cluster-cleaner. Only it may change the annotations the controller tracks the limits of clusters in. They are not protected if it is not set.")
+	flag.DurationVar(&extensionBudget, "extension-budget", 0, "Sum of all extensions a cluster may get with the extend-by annotation. Zero disables the limit.")
+	flag.StringVar(&warningStages, "warning-stages", "", "Comma separated durations before the deletion at which a ClusterMarkedForDeletion event is sent, e.g. 24h,15m. The warning lead time of the cleanup policy is always a stage.")
+	flag.StringVar(&notificationConfig, "notification-config", "", "Path of the YAML file configuring the notification sinks. Notifications are disabled if it is not set.")
+	flag.DurationVar(&eventDeduplicationWindow, "event-deduplication-window", 10*time.Minute, "How long an identical event about the same object is not recorded again. Zero disables the deduplication.")
+	flag.DurationVar(&metricsRetention, "metrics-retention", time.Hour, "How long the counter metrics of a cluster are kept after it is gone. Zero deletes them right away.")
+	flag.StringVar(&digestTime, "digest-time", "", "Time of day in UTC at which the daily digest of all clusters is sent with the notification sinks, e.g. 08:00. The digest is disabled if it is not set.")
+	flag.StringVar(&messagesDir, "messages-dir", "", "Directory with templates overriding the messages of events and notifications, one file per message. The default messages are used if it is not set.")
 	opts := zap.Options{
 		Development: false,
 	}
@@ -63,6 +105,45 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	keepUntilBehaviour, err := policy.ParseInvalidKeepUntilBehaviour(invalidKeepUntilBehaviour)
+	if err != nil {
+		setupLog.Error(err, "invalid flag value")
+		os.Exit(1)
+	}
+	keepUntilBasis, err := policy.ParseKeepUntilBasis(maxKeepUntilBasis)
+	if err != nil {
+		setupLog.Error(err, "invalid flag value")
+		os.Exit(1)
+	}
+	stages, err := controllers.ParseWarningStages(warningStages)
+	if err != nil {
+		setupLog.Error(err, "invalid flag value")
+		os.Exit(1)
+	}
+	var digestAt time.Duration
+	if digestTime != "" {
+		if notificationConfig == "" {
+			setupLog.Error(errors.New("--digest-time requires --notification-config"), "invalid flag value")
+			os.Exit(1)
+		}
+		digestAt, err = controllers.ParseDigestTime(digestTime)
+		if err != nil {
+			setupLog.Error(err, "invalid flag value")
+			os.Exit(1)
+		}
+	}
+	options := controllers.Options{
+		Config: policy.Config{
+			InvalidKeepUntilBehaviour: keepUntilBehaviour,
+			MaxIgnorePeriod:           maxIgnorePeriod,
+			MaxKeepUntilHorizon:       maxKeepUntilHorizon,
+			MaxKeepUntilBasis:         keepUntilBasis,
+			WarningStages:             stages,
+		},
+		IgnoreWarningThreshold: ignoreWarningThreshold,
+		ExtensionBudget:        extensionBudget,
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme: scheme,
 		Metrics: metricsserver.Options{
@@ -80,15 +161,85 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err = (&controllers.ClusterReconciler{
+	var notifier notification.Notifier
+	if notificationConfig != "" {
+		config, err := notification.LoadConfig(notificationConfig)
+		if err != nil {
+			setupLog.Error(err, "unable to load notification config")
+			os.Exit(1)
+		}
+		sinks, err := config.Sinks()
+		if err != nil {
+			setupLog.Error(err, "unable to create notification sinks")
+			os.Exit(1)
+		}
+		dispatcher := notification.NewDispatcher(ctrl.Log.WithName("notification"), sinks...)
+		if err := mgr.Add(dispatcher); err != nil {
+			setupLog.Error(err, "unable to add notification dispatcher")
+			os.Exit(1)
+		}
+		notifier = dispatcher
+	}
+
+	var messages *controllers.Messages
+	if messagesDir != "" {
+		messages, err = controllers.LoadMessages(messagesDir)
+		if err != nil {
+			setupLog.Error(err, "unable to load message templates")
+			os.Exit(1)
+		}
+	}
+
+	clusterReconciler := &controllers.ClusterReconciler{
+		Client:   mgr.GetClient(),
+		Log:      ctrl.Log.WithName("controllers").WithName("Cluster"),
+		Scheme:   mgr.GetScheme(),
+		DryRun:   dryRun,
+		Notifier: notifier,
+		Messages: messages,
+
+		EventDeduplicationWindow: eventDeduplicationWindow,
+		MetricsRetention:         metricsRetention,
+
+		Options: options,
+	}
+	if err = clusterReconciler.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Cluster")
+		os.Exit(1)
+	}
+	if digestTime != "" {
+		if err := mgr.Add(controllers.NewDigestReporter(clusterReconciler, digestAt)); err != nil {
+			setupLog.Error(err, "unable to add digest reporter")
+			os.Exit(1)
+		}
+	}
+	if err = (&controllers.CleanupPolicyReconciler{
 		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("Cluster"),
+		Log:    ctrl.Log.WithName("controllers").WithName("CleanupPolicy"),
 		Scheme: mgr.GetScheme(),
-		DryRun: dryRun,
 	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "Cluster")
+		setupLog.Error(err, "unable to create controller", "controller", "CleanupPolicy")
 		os.Exit(1)
 	}
+	if webhookEnabled {
+		if err = (&controllers.ClusterValidator{
+			Options:             options,
+			IgnoreAllowedUsers:  splitList(ignoreAllowedUsers),
+			IgnoreAllowedGroups: splitList(ignoreAllowedGroups),
+			ControllerUsername:  controllerUsername,
+		}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Cluster")
+			os.Exit(1)
+		}
+		if err = (&controllers.ClusterDefaulter{
+			Client: mgr.GetClient(),
+
+			Options: options,
+		}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Cluster")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -106,3 +257,15 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// splitList splits a comma separated flag value, dropping empty items.
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
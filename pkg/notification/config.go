@@ -0,0 +1,87 @@
+package notification
+
+import (
+	"net/url"
+	"os"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+// Config configures the notification sinks. Sinks which are not configured are disabled.
+type Config struct {
+	Slack   *SlackConfig   `json:"slack,omitempty"`
+	Webhook *WebhookConfig `json:"webhook,omitempty"`
+	Email   *EmailConfig   `json:"email,omitempty"`
+}
+
+// LoadConfig reads the YAML notification config from the given file.
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, errors.Wrapf(err, "failed reading notification config %s", path)
+	}
+
+	var config Config
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return Config{}, errors.Wrapf(err, "failed parsing notification config %s", path)
+	}
+	if err := config.validate(); err != nil {
+		return Config{}, errors.Wrapf(err, "invalid notification config %s", path)
+	}
+
+	return config, nil
+}
+
+// Sinks returns the configured sinks.
+func (c Config) Sinks() ([]Sink, error) {
+	var sinks []Sink
+	if c.Slack != nil {
+		sinks = append(sinks, NewSlackSink(*c.Slack))
+	}
+	if c.Webhook != nil {
+		sinks = append(sinks, NewWebhookSink(*c.Webhook))
+	}
+	if c.Email != nil {
+		sink, err := NewEmailSink(*c.Email)
+		if err != nil {
+			return nil, errors.Wrap(err, "email")
+		}
+		sinks = append(sinks, sink)
+	}
+
+	return sinks, nil
+}
+
+func (c Config) validate() error {
+	if c.Slack != nil {
+		if err := c.Slack.validate(); err != nil {
+			return errors.Wrap(err, "slack")
+		}
+	}
+	if c.Webhook != nil {
+		if err := c.Webhook.validate(); err != nil {
+			return errors.Wrap(err, "webhook")
+		}
+	}
+	if c.Email != nil {
+		if err := c.Email.validate(); err != nil {
+			return errors.Wrap(err, "email")
+		}
+	}
+
+	return nil
+}
+
+func validateURL(v string) error {
+	// the url is not part of the error, it usually contains a secret
+	u, err := url.Parse(v)
+	if err != nil {
+		return errors.New("url can not be parsed")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.Errorf("url %q must use http or https", u.Redacted())
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package notification
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// digestTimeLayout is the layout of points in time in the Markdown digest.
+const digestTimeLayout = "2006-01-02 15:04 MST"
+
+// Digest is the periodic report about all clusters. It is sent as notification of KindDigest.
+type Digest struct {
+	// Time is when the digest was computed.
+	Time time.Time `json:"time"`
+	// Until is the end of the window of upcoming deletions.
+	Until time.Time `json:"until"`
+
+	// Deleting are the clusters which are going to be deleted before Until, the earliest first.
+	Deleting []DigestEntry `json:"deleting"`
+	// Ignored are the clusters which are ignored for deletion, with the reason why.
+	Ignored []DigestEntry `json:"ignored"`
+	// Protected are the clusters which are kept by a `keep-until` value in the future.
+	Protected []DigestEntry `json:"protected"`
+	// Failed are the clusters whose deletion failed, with the error.
+	Failed []DigestEntry `json:"failed"`
+}
+
+// DigestEntry is a cluster listed in a digest.
+type DigestEntry struct {
+	Cluster   string `json:"cluster"`
+	Namespace string `json:"namespace"`
+	Owner     string `json:"owner,omitempty"`
+	// Deadline is when the cluster is going to be deleted. It is zero if it is not going to be deleted.
+	Deadline time.Time `json:"deadline,omitzero"`
+	// Reason is why an ignored cluster is ignored, e.g. `flux`.
+	Reason string `json:"reason,omitempty"`
+	// Message is the error of a failed deletion.
+	Message string `json:"message,omitempty"`
+}
+
+// Summary returns a single line describing the digest.
+func (d Digest) Summary() string {
+	return fmt.Sprintf("%d cluster(s) to be deleted until %s, %d ignored, %d protected by keep-until, %d failed deletion(s)",
+		len(d.Deleting), d.Until.UTC().Format(digestTimeLayout), len(d.Ignored), len(d.Protected), len(d.Failed))
+}
+
+// JSON returns the digest as JSON document.
+func (d Digest) JSON() ([]byte, error) {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed encoding digest")
+	}
+
+	return data, nil
+}
+
+// Markdown returns the digest as Markdown document with a section per state.
+func (d Digest) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Cluster cleaner digest of %s\n", d.Time.UTC().Format(digestTimeLayout))
+
+	writeDigestSection(&b, fmt.Sprintf("To be deleted until %s", d.Until.UTC().Format(digestTimeLayout)), d.Deleting, func(e DigestEntry) string {
+		return "at " + e.Deadline.UTC().Format(digestTimeLayout)
+	})
+	writeDigestSection(&b, "Ignored", d.Ignored, func(e DigestEntry) string {
+		return "reason: " + e.Reason
+	})
+	writeDigestSection(&b, "Protected by keep-until", d.Protected, func(e DigestEntry) string {
+		return "kept until " + e.Deadline.UTC().Format(digestTimeLayout)
+	})
+	writeDigestSection(&b, "Failed deletions", d.Failed, func(e DigestEntry) string {
+		return e.Message
+	})
+
+	return b.String()
+}
+
+func writeDigestSection(b *strings.Builder, title string, entries []DigestEntry, detail func(DigestEntry) string) {
+	fmt.Fprintf(b, "\n## %s (%d)\n\n", title, len(entries))
+	if len(entries) == 0 {
+		b.WriteString("None.\n")
+		return
+	}
+	for _, e := range entries {
+		fmt.Fprintf(b, "- `%s/%s`", e.Namespace, e.Cluster)
+		if e.Owner != "" {
+			fmt.Fprintf(b, " of %s", e.Owner)
+		}
+		if v := detail(e); v != "" {
+			fmt.Fprintf(b, ": %s", strings.Join(strings.Fields(v), " "))
+		}
+		b.WriteString("\n")
+	}
+}
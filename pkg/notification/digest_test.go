@@ -0,0 +1,105 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestDigest() Digest {
+	now := time.Date(2022, 2, 1, 8, 0, 0, 0, time.UTC)
+
+	return Digest{
+		Time:  now,
+		Until: now.Add(24 * time.Hour),
+		Deleting: []DigestEntry{
+			{Cluster: "one", Namespace: "org-acme", Owner: "alice@example.com", Deadline: now.Add(time.Hour)},
+		},
+		Ignored: []DigestEntry{
+			{Cluster: "two", Namespace: "org-acme", Reason: "flux"},
+		},
+		Failed: []DigestEntry{
+			{Cluster: "three", Namespace: "org-acme", Message: "failed deleting App CR:\nforbidden"},
+		},
+	}
+}
+
+func TestDigestMarkdown(t *testing.T) {
+	assert.Equal(t, "# Cluster cleaner digest of 2022-02-01 08:00 UTC\n"+
+		"\n## To be deleted until 2022-02-02 08:00 UTC (1)\n\n"+
+		"- `org-acme/one` of alice@example.com: at 2022-02-01 09:00 UTC\n"+
+		"\n## Ignored (1)\n\n"+
+		"- `org-acme/two`: reason: flux\n"+
+		"\n## Protected by keep-until (0)\n\n"+
+		"None.\n"+
+		"\n## Failed deletions (1)\n\n"+
+		"- `org-acme/three`: failed deleting App CR: forbidden\n", newTestDigest().Markdown())
+}
+
+func TestDigestJSON(t *testing.T) {
+	data, err := newTestDigest().JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded map[string]any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "2022-02-02T08:00:00Z", decoded["until"])
+	assert.Equal(t, []any{map[string]any{
+		"cluster":   "one",
+		"namespace": "org-acme",
+		"owner":     "alice@example.com",
+		"deadline":  "2022-02-01T09:00:00Z",
+	}}, decoded["deleting"])
+	assert.Equal(t, []any{map[string]any{"cluster": "two", "namespace": "org-acme", "reason": "flux"}}, decoded["ignored"])
+	assert.Nil(t, decoded["protected"])
+}
+
+func TestWebhookSinkDigest(t *testing.T) {
+	server := newWebhookServer(t)
+	sink := newTestWebhookSink(WebhookConfig{
+		WebhookEndpoint: WebhookEndpoint{URL: server.URL + "/default"},
+		Namespaces:      map[string]WebhookEndpoint{"org-acme": {URL: server.URL + "/acme"}},
+		QueueDir:        t.TempDir(),
+	})
+
+	digest := newTestDigest()
+	if err := sink.Send(context.TODO(), Notification{Kind: KindDigest, Message: digest.Summary(), Time: digest.Time, Digest: &digest}); err != nil {
+		t.Fatal(err)
+	}
+
+	delivered := server.delivered()
+	if !assert.Len(t, delivered, 1) {
+		return
+	}
+	assert.Equal(t, "/default", delivered[0].path)
+	assert.Equal(t, EventTypePrefix+"digest", delivered[0].event.Type)
+	assert.Empty(t, delivered[0].event.Subject)
+	assert.Equal(t, &digest, delivered[0].event.Data.Digest)
+}
+
+func TestEmailSinkDigest(t *testing.T) {
+	server := newSMTPServer(t)
+	sink := newTestEmailSink(t, server, EmailConfig{DigestRecipients: []string{"platform@example.com", "oncall@example.com"}})
+
+	digest := newTestDigest()
+	if err := sink.Send(context.TODO(), Notification{Kind: KindDigest, Digest: &digest}); err != nil {
+		t.Fatal(err)
+	}
+
+	// digests are not batched
+	emails := server.emails()
+	if !assert.Len(t, emails, 2) {
+		return
+	}
+	assert.Equal(t, []string{"platform@example.com"}, emails[0].recipients)
+	assert.Equal(t, []string{"oncall@example.com"}, emails[1].recipients)
+	assert.Equal(t, "[cluster-cleaner] Digest: "+digest.Summary(), decodeHeader(t, emails[0].message.Header.Get("Subject")))
+	assert.Equal(t, "text/markdown; charset=utf-8", emails[0].message.Header.Get("Content-Type"))
+	assert.Equal(t, digest.Markdown(), emails[0].body)
+}
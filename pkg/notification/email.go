@@ -0,0 +1,405 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+const (
+	defaultSMTPPort    = 587
+	defaultBatchWindow = 5 * time.Minute
+	// flushTimeout is how long the last batches may take to be sent on shutdown.
+	flushTimeout = 10 * time.Second
+
+	defaultEmailSubject = `[cluster-cleaner] {{ with .Marked }}{{ len . }} cluster(s) about to be deleted{{ end }}
+{{- if and .Marked .Deleted }}, {{ end }}{{ with .Deleted }}{{ len . }} cluster(s) deleted{{ end }}`
+
+	defaultEmailBody = `Hello,
+{{ with .Marked }}
+the following clusters are about to be deleted:
+{{ range . }}
+- {{ .Namespace }}/{{ .Cluster }}: {{ .Message }}{{ if not .Deadline.IsZero }} Deadline: {{ .Deadline.UTC.Format "2006-01-02 15:04 MST" }}.{{ end }}
+{{- end }}
+
+To keep a cluster longer, annotate it with cluster-cleaner.giantswarm.io/extend-by and a duration, e.g. 24h.
+{{ end }}{{ with .Deleted }}
+the following clusters were deleted:
+{{ range . }}
+- {{ .Namespace }}/{{ .Cluster }}: {{ .Message }}
+{{- end }}
+{{ end }}
+--
+cluster-cleaner
+`
+)
+
+// EmailConfig configures the email sink.
+type EmailConfig struct {
+	// Host and Port of the SMTP server. The connection is upgraded with STARTTLS if the server supports it.
+	Host string `json:"host"`
+	Port int    `json:"port,omitempty"`
+
+	// Username and Password authenticate with PLAIN auth if set, which requires TLS unless the server is on localhost.
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+
+	// From is the sender address, e.g. `cluster-cleaner@example.com`.
+	From string `json:"from"`
+
+	// Organizations maps organizations to the recipient for their clusters without an owner email.
+	Organizations map[string]string `json:"organizations,omitempty"`
+
+	// DigestRecipients get the periodic digest about all clusters. The digest is not emailed if it is empty.
+	DigestRecipients []string `json:"digestRecipients,omitempty"`
+
+	// BatchWindow is how long notifications are collected before one email per recipient is sent. Defaults to 5m.
+	BatchWindow metav1.Duration `json:"batchWindow,omitempty"`
+
+	// SubjectTemplate and BodyTemplate are Go templates of the email, executed with the emailData of a batch.
+	SubjectTemplate string `json:"subjectTemplate,omitempty"`
+	BodyTemplate    string `json:"bodyTemplate,omitempty"`
+
+	// Retries is how often a failed email is retried. Defaults to 3.
+	Retries *int `json:"retries,omitempty"`
+}
+
+func (c EmailConfig) validate() error {
+	if c.Host == "" {
+		return errors.New("host must be set")
+	}
+	if c.Port < 0 {
+		return errors.New("port must not be negative")
+	}
+	if _, err := mail.ParseAddress(c.From); err != nil {
+		return errors.Wrap(err, "from")
+	}
+	for organization, recipient := range c.Organizations {
+		if _, err := mail.ParseAddress(recipient); err != nil {
+			return errors.Wrapf(err, "organizations[%s]", organization)
+		}
+	}
+	for i, recipient := range c.DigestRecipients {
+		if _, err := mail.ParseAddress(recipient); err != nil {
+			return errors.Wrapf(err, "digestRecipients[%d]", i)
+		}
+	}
+	if c.BatchWindow.Duration < 0 {
+		return errors.New("batchWindow must not be negative")
+	}
+	if _, _, err := c.templates(); err != nil {
+		return err
+	}
+	if c.Retries != nil && *c.Retries < 0 {
+		return errors.New("retries must not be negative")
+	}
+
+	return nil
+}
+
+func (c EmailConfig) templates() (*template.Template, *template.Template, error) {
+	subjectTemplate := c.SubjectTemplate
+	if subjectTemplate == "" {
+		subjectTemplate = defaultEmailSubject
+	}
+	bodyTemplate := c.BodyTemplate
+	if bodyTemplate == "" {
+		bodyTemplate = defaultEmailBody
+	}
+
+	subject, err := template.New("subject").Option("missingkey=error").Parse(subjectTemplate)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "subjectTemplate")
+	}
+	body, err := template.New("body").Option("missingkey=error").Parse(bodyTemplate)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "bodyTemplate")
+	}
+
+	// execute the templates once, so mistakes like unknown fields are found at startup and not with the first batch
+	if err := subject.Execute(io.Discard, sampleEmailData); err != nil {
+		return nil, nil, errors.Wrap(err, "subjectTemplate")
+	}
+	if err := body.Execute(io.Discard, sampleEmailData); err != nil {
+		return nil, nil, errors.Wrap(err, "bodyTemplate")
+	}
+
+	return subject, body, nil
+}
+
+// emailData is passed to the email templates. Marked and Deleted contain the notifications of the batch by kind.
+type emailData struct {
+	Recipient     string
+	Notifications []Notification
+	Marked        []Notification
+	Deleted       []Notification
+}
+
+func newEmailData(recipient string, notifications []Notification) emailData {
+	data := emailData{Recipient: recipient, Notifications: notifications}
+	for _, n := range notifications {
+		switch n.Kind {
+		case KindMarked:
+			data.Marked = append(data.Marked, n)
+		case KindDeleted:
+			data.Deleted = append(data.Deleted, n)
+		}
+	}
+
+	return data
+}
+
+var sampleEmailData = newEmailData("alice@example.com", []Notification{
+	{
+		Kind:       KindMarked,
+		Cluster:    "sample",
+		Namespace:  "org-sample",
+		Owner:      "alice",
+		OwnerEmail: "alice@example.com",
+		Deadline:   time.Date(2022, 2, 1, 12, 0, 0, 0, time.UTC),
+		Message:    "Cluster will be deleted in aprox. 60 min.",
+		Time:       time.Date(2022, 2, 1, 11, 0, 0, 0, time.UTC),
+	},
+	{
+		Kind:       KindDeleted,
+		Cluster:    "sample",
+		Namespace:  "org-sample",
+		Owner:      "alice",
+		OwnerEmail: "alice@example.com",
+		Message:    "Cluster was deleted.",
+		Time:       time.Date(2022, 2, 1, 12, 0, 0, 0, time.UTC),
+	},
+})
+
+// EmailSink emails the owners of clusters before and after their deletion. Notifications are collected per recipient
+// for the batch window, so an owner of many clusters gets a single email.
+type EmailSink struct {
+	addr          string
+	auth          smtp.Auth
+	from          string
+	organizations map[string]string
+	digestTo      []string
+	subject       *template.Template
+	body          *template.Template
+	batchWindow   time.Duration
+	retries       int
+	backoff       time.Duration
+
+	mu      sync.Mutex
+	batches map[string][]Notification
+}
+
+// NewEmailSink returns an EmailSink for the given config.
+func NewEmailSink(c EmailConfig) (*EmailSink, error) {
+	subject, body, err := c.templates()
+	if err != nil {
+		return nil, err
+	}
+
+	port := c.Port
+	if port == 0 {
+		port = defaultSMTPPort
+	}
+	var auth smtp.Auth
+	if c.Username != "" {
+		auth = smtp.PlainAuth("", c.Username, c.Password, c.Host)
+	}
+	batchWindow := c.BatchWindow.Duration
+	if batchWindow == 0 {
+		batchWindow = defaultBatchWindow
+	}
+	retries := defaultRetries
+	if c.Retries != nil {
+		retries = *c.Retries
+	}
+
+	return &EmailSink{
+		addr:          net.JoinHostPort(c.Host, strconv.Itoa(port)),
+		auth:          auth,
+		from:          c.From,
+		organizations: c.Organizations,
+		digestTo:      c.DigestRecipients,
+		subject:       subject,
+		body:          body,
+		batchWindow:   batchWindow,
+		retries:       retries,
+		backoff:       defaultBackoff,
+		batches:       map[string][]Notification{},
+	}, nil
+}
+
+// Name returns the name of the sink.
+func (s *EmailSink) Name() string {
+	return "email"
+}
+
+// Send adds the notification to the batch of its recipient. Only upcoming and completed deletions are emailed,
+// notifications without a recipient are skipped. Digests are emailed to the digest recipients right away.
+func (s *EmailSink) Send(ctx context.Context, n Notification) error {
+	if n.Kind == KindDigest {
+		return s.sendDigest(ctx, n)
+	}
+	if n.Kind != KindMarked && n.Kind != KindDeleted {
+		return nil
+	}
+	recipient := s.recipient(n)
+	if recipient == "" {
+		return nil
+	}
+	address, err := mail.ParseAddress(recipient)
+	if err != nil {
+		return errors.Errorf("invalid recipient %q for cluster %s/%s", recipient, n.Namespace, n.Cluster)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches[address.Address] = append(s.batches[address.Address], n)
+
+	return nil
+}
+
+// Run sends the batches at the end of every batch window, and the last batches when the context is cancelled.
+func (s *EmailSink) Run(ctx context.Context) {
+	log := logr.FromContextOrDiscard(ctx)
+	ticker := time.NewTicker(s.batchWindow)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), flushTimeout)
+			defer cancel()
+			if err := s.flush(flushCtx); err != nil {
+				log.Error(err, "failed sending emails")
+			}
+			return
+		case <-ticker.C:
+			if err := s.flush(ctx); err != nil {
+				log.Error(err, "failed sending emails")
+			}
+		}
+	}
+}
+
+// flush sends one email per recipient with all notifications collected for them.
+func (s *EmailSink) flush(ctx context.Context) error {
+	s.mu.Lock()
+	batches := s.batches
+	s.batches = map[string][]Notification{}
+	s.mu.Unlock()
+
+	recipients := make([]string, 0, len(batches))
+	for recipient := range batches {
+		recipients = append(recipients, recipient)
+	}
+	slices.Sort(recipients)
+
+	var errs []error
+	for _, recipient := range recipients {
+		msg, err := s.message(recipient, batches[recipient])
+		if err == nil {
+			err = retry(ctx, s.retries, s.backoff, func() (time.Duration, error) {
+				return 0, s.sendMail(recipient, msg)
+			})
+		}
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "failed sending email to %s", recipient))
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// sendDigest emails the digest as Markdown to every digest recipient.
+func (s *EmailSink) sendDigest(ctx context.Context, n Notification) error {
+	if n.Digest == nil {
+		return nil
+	}
+
+	var errs []error
+	for _, recipient := range s.digestTo {
+		msg := s.newMessage(recipient, "[cluster-cleaner] Digest: "+n.Digest.Summary(), n.Digest.Markdown(), "text/markdown")
+		err := retry(ctx, s.retries, s.backoff, func() (time.Duration, error) {
+			return 0, s.sendMail(recipient, msg)
+		})
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "failed sending digest to %s", recipient))
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+func (s *EmailSink) sendMail(recipient string, msg []byte) error {
+	err := smtp.SendMail(s.addr, s.auth, s.from, []string{recipient}, msg)
+	// the server rejected the email permanently, e.g. because the recipient does not exist
+	var protocolErr *textproto.Error
+	if errors.As(err, &protocolErr) && protocolErr.Code >= 500 {
+		return permanentError{err}
+	}
+
+	return err
+}
+
+// message renders the email for the recipient.
+func (s *EmailSink) message(recipient string, notifications []Notification) ([]byte, error) {
+	data := newEmailData(recipient, notifications)
+
+	var subject, body bytes.Buffer
+	if err := s.subject.Execute(&subject, data); err != nil {
+		return nil, errors.Wrap(err, "failed rendering email subject")
+	}
+	if err := s.body.Execute(&body, data); err != nil {
+		return nil, errors.Wrap(err, "failed rendering email body")
+	}
+
+	return s.newMessage(recipient, subject.String(), body.String(), "text/plain"), nil
+}
+
+// newMessage returns the email with the given subject and body of the given media type.
+func (s *EmailSink) newMessage(recipient, subject, body, mediaType string) []byte {
+	var msg bytes.Buffer
+	headers := [][2]string{
+		{"From", s.from},
+		{"To", recipient},
+		// line breaks in the subject would start new headers
+		{"Subject", mime.QEncoding.Encode("utf-8", strings.Join(strings.Fields(subject), " "))},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", mediaType + "; charset=utf-8"},
+		{"Content-Transfer-Encoding", "8bit"},
+	}
+	for _, header := range headers {
+		fmt.Fprintf(&msg, "%s: %s\r\n", header[0], header[1])
+	}
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	return msg.Bytes()
+}
+
+// recipient returns the owner email of the cluster, or the recipient configured for its organization.
+func (s *EmailSink) recipient(n Notification) string {
+	if n.OwnerEmail != "" {
+		return n.OwnerEmail
+	}
+
+	return s.organizations[n.Organization]
+}
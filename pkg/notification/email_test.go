@@ -0,0 +1,372 @@
+package notification
+
+import (
+	"bufio"
+	"context"
+	"mime"
+	"net"
+	"net/mail"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type receivedEmail struct {
+	from       string
+	recipients []string
+	message    *mail.Message
+	body       string
+}
+
+// smtpServer is a minimal stand-in for an SMTP server. It answers the DATA command of the first emails with the given
+// reply codes, and accepts all emails once they are used up.
+type smtpServer struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	replies  []string
+	received []receivedEmail
+}
+
+func newSMTPServer(t *testing.T, replies ...string) *smtpServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpServer{listener: listener, replies: replies}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(t, conn)
+		}
+	}()
+
+	return s
+}
+
+func (s *smtpServer) serve(t *testing.T, conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) {
+		_, _ = conn.Write([]byte(line + "\r\n"))
+	}
+
+	var email receivedEmail
+	reply("220 localhost ESMTP")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.TrimRight(line, "\r\n")
+		switch verb := strings.ToUpper(strings.SplitN(command, " ", 2)[0]); verb {
+		case "EHLO", "HELO":
+			reply("250 localhost")
+		case "MAIL":
+			email = receivedEmail{from: strings.Trim(strings.TrimPrefix(command, "MAIL FROM:"), "<>")}
+			reply("250 OK")
+		case "RCPT":
+			email.recipients = append(email.recipients, strings.Trim(strings.TrimPrefix(command, "RCPT TO:"), "<>"))
+			reply("250 OK")
+		case "DATA":
+			reply("354 Start mail input")
+			var data strings.Builder
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+
+			s.mu.Lock()
+			if len(s.replies) > 0 {
+				code := s.replies[0]
+				s.replies = s.replies[1:]
+				s.mu.Unlock()
+				reply(code)
+				continue
+			}
+			message, err := mail.ReadMessage(strings.NewReader(data.String()))
+			if err != nil {
+				t.Errorf("failed parsing email: %v", err)
+			}
+			body := new(strings.Builder)
+			if message != nil {
+				_, _ = bufio.NewReader(message.Body).WriteTo(body)
+			}
+			email.message = message
+			email.body = strings.ReplaceAll(body.String(), "\r\n", "\n")
+			s.received = append(s.received, email)
+			s.mu.Unlock()
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func (s *smtpServer) emails() []receivedEmail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]receivedEmail(nil), s.received...)
+}
+
+func newTestEmailSink(t *testing.T, server *smtpServer, c EmailConfig) *EmailSink {
+	host, port, err := net.SplitHostPort(server.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Host = host
+	c.Port, _ = strconv.Atoi(port)
+	if c.From == "" {
+		c.From = "cluster-cleaner@example.com"
+	}
+	if err := c.validate(); err != nil {
+		t.Fatal(err)
+	}
+	sink, err := NewEmailSink(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.backoff = time.Millisecond
+
+	return sink
+}
+
+func TestEmailSinkBatches(t *testing.T) {
+	deadline := time.Date(2022, 2, 1, 13, 0, 0, 0, time.UTC)
+	server := newSMTPServer(t)
+	sink := newTestEmailSink(t, server, EmailConfig{Organizations: map[string]string{"acme": "team@acme.example.com"}})
+
+	notifications := []Notification{
+		{Kind: KindMarked, Cluster: "one", Namespace: "org-acme", OwnerEmail: "alice@example.com", Deadline: deadline, Message: "Cluster will be deleted in aprox. 60 min."},
+		{Kind: KindDeleted, Cluster: "two", Namespace: "org-acme", OwnerEmail: "Alice <alice@example.com>", Message: "Cluster was deleted."},
+		{Kind: KindMarked, Cluster: "three", Namespace: "org-acme", Organization: "acme", Deadline: deadline, Message: "Cluster will be deleted in aprox. 60 min."},
+		// not emailed, ignored clusters and clusters without a recipient
+		{Kind: KindIgnored, Cluster: "four", Namespace: "org-acme", OwnerEmail: "alice@example.com"},
+		{Kind: KindDeleted, Cluster: "five", Namespace: "org-other", Organization: "other"},
+	}
+	for _, n := range notifications {
+		if err := sink.Send(context.TODO(), n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Empty(t, server.emails(), "emails must not be sent before the batch window ends")
+
+	if err := sink.flush(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	emails := server.emails()
+	if !assert.Len(t, emails, 2) {
+		return
+	}
+
+	alice := emails[0]
+	assert.Equal(t, []string{"alice@example.com"}, alice.recipients)
+	assert.Equal(t, "cluster-cleaner@example.com", alice.from)
+	assert.Equal(t, "alice@example.com", alice.message.Header.Get("To"))
+	assert.Equal(t, "[cluster-cleaner] 1 cluster(s) about to be deleted, 1 cluster(s) deleted", decodeHeader(t, alice.message.Header.Get("Subject")))
+	assert.Equal(t, `Hello,
+
+the following clusters are about to be deleted:
+
+- org-acme/one: Cluster will be deleted in aprox. 60 min. Deadline: 2022-02-01 13:00 UTC.
+
+To keep a cluster longer, annotate it with cluster-cleaner.giantswarm.io/extend-by and a duration, e.g. 24h.
+
+the following clusters were deleted:
+
+- org-acme/two: Cluster was deleted.
+
+--
+cluster-cleaner
+`, alice.body)
+
+	team := emails[1]
+	assert.Equal(t, []string{"team@acme.example.com"}, team.recipients)
+	assert.Equal(t, "[cluster-cleaner] 1 cluster(s) about to be deleted", decodeHeader(t, team.message.Header.Get("Subject")))
+	assert.Contains(t, team.body, "- org-acme/three: ")
+
+	// batches are sent once
+	if err := sink.flush(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, server.emails(), 2)
+}
+
+func TestEmailSinkTemplates(t *testing.T) {
+	server := newSMTPServer(t)
+	sink := newTestEmailSink(t, server, EmailConfig{
+		SubjectTemplate: "Clusters of {{ .Recipient }}",
+		BodyTemplate:    "{{ range .Notifications }}{{ .Cluster }} {{ .Kind }}\n{{ end }}",
+	})
+
+	for _, n := range []Notification{
+		{Kind: KindMarked, Cluster: "one", Namespace: "default", OwnerEmail: "bob@example.com"},
+		{Kind: KindDeleted, Cluster: "one", Namespace: "default", OwnerEmail: "bob@example.com"},
+	} {
+		if err := sink.Send(context.TODO(), n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.flush(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	emails := server.emails()
+	if !assert.Len(t, emails, 1) {
+		return
+	}
+	assert.Equal(t, "Clusters of bob@example.com", decodeHeader(t, emails[0].message.Header.Get("Subject")))
+	assert.Equal(t, "one marked\none deleted\n", emails[0].body)
+}
+
+func TestEmailSinkRetries(t *testing.T) {
+	testCases := []struct {
+		name          string
+		replies       []string
+		expectedError bool
+		expectedSent  bool
+	}{
+		{
+			name:         "case 0 - retried after temporary failures",
+			replies:      []string{"451 Try again later", "421 Service not available"},
+			expectedSent: true,
+		},
+		{
+			name:          "case 1 - permanent failures are not retried",
+			replies:       []string{"550 No such user"},
+			expectedError: true,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			server := newSMTPServer(t, tc.replies...)
+			sink := newTestEmailSink(t, server, EmailConfig{})
+
+			if err := sink.Send(context.TODO(), Notification{Kind: KindDeleted, Cluster: "one", Namespace: "default", OwnerEmail: "bob@example.com"}); err != nil {
+				t.Fatal(err)
+			}
+			err := sink.flush(context.TODO())
+			if tc.expectedError {
+				assert.Error(t, err, "test case %v failed.", tc.name)
+			} else {
+				assert.NoError(t, err, "test case %v failed.", tc.name)
+			}
+			assert.Equal(t, tc.expectedSent, len(server.emails()) == 1, "test case %v failed.", tc.name)
+
+			server.mu.Lock()
+			defer server.mu.Unlock()
+			assert.Empty(t, server.replies, "test case %v failed. not all replies were used", tc.name)
+		})
+	}
+}
+
+func TestEmailSinkRun(t *testing.T) {
+	server := newSMTPServer(t)
+	sink := newTestEmailSink(t, server, EmailConfig{BatchWindow: metav1.Duration{Duration: 50 * time.Millisecond}})
+
+	ctx, cancel := context.WithCancel(logr.NewContext(context.TODO(), logr.Discard()))
+	done := make(chan struct{})
+	go func() {
+		sink.Run(ctx)
+		close(done)
+	}()
+
+	if err := sink.Send(ctx, Notification{Kind: KindMarked, Cluster: "one", Namespace: "default", OwnerEmail: "bob@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	assert.Eventually(t, func() bool {
+		return len(server.emails()) == 1
+	}, 5*time.Second, 10*time.Millisecond, "batch was not sent at the end of the window")
+
+	// the last batch is sent on shutdown
+	if err := sink.Send(ctx, Notification{Kind: KindDeleted, Cluster: "one", Namespace: "default", OwnerEmail: "bob@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	<-done
+	assert.Len(t, server.emails(), 2)
+}
+
+func TestEmailConfig(t *testing.T) {
+	testCases := []struct {
+		name          string
+		config        EmailConfig
+		expectedError bool
+	}{
+		{
+			name:   "case 0 - valid",
+			config: EmailConfig{Host: "smtp.example.com", From: "cluster-cleaner@example.com", Organizations: map[string]string{"acme": "team@acme.example.com"}},
+		},
+		{
+			name:          "case 1 - missing host",
+			config:        EmailConfig{From: "cluster-cleaner@example.com"},
+			expectedError: true,
+		},
+		{
+			name:          "case 2 - invalid sender",
+			config:        EmailConfig{Host: "smtp.example.com", From: "cluster-cleaner"},
+			expectedError: true,
+		},
+		{
+			name:          "case 3 - invalid organization recipient",
+			config:        EmailConfig{Host: "smtp.example.com", From: "cluster-cleaner@example.com", Organizations: map[string]string{"acme": "team"}},
+			expectedError: true,
+		},
+		{
+			name:          "case 4 - invalid template",
+			config:        EmailConfig{Host: "smtp.example.com", From: "cluster-cleaner@example.com", BodyTemplate: "{{ range .Notifications }}"},
+			expectedError: true,
+		},
+		{
+			name:          "case 5 - invalid digest recipient",
+			config:        EmailConfig{Host: "smtp.example.com", From: "cluster-cleaner@example.com", DigestRecipients: []string{"platform"}},
+			expectedError: true,
+		},
+		{
+			name:          "case 6 - template with unknown field",
+			config:        EmailConfig{Host: "smtp.example.com", From: "cluster-cleaner@example.com", SubjectTemplate: "{{ .Owner }}"},
+			expectedError: true,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			err := tc.config.validate()
+			if tc.expectedError {
+				assert.Error(t, err, "test case %v failed.", tc.name)
+			} else {
+				assert.NoError(t, err, "test case %v failed.", tc.name)
+			}
+		})
+	}
+}
+
+func decodeHeader(t *testing.T, v string) string {
+	decoded, err := new(mime.WordDecoder).DecodeHeader(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return decoded
+}
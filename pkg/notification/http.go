@@ -0,0 +1,76 @@
+package notification
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultRetries = 3
+	defaultBackoff = 1 * time.Second
+	requestTimeout = 10 * time.Second
+)
+
+// permanentError marks errors which are not going to go away with a retry.
+type permanentError struct {
+	error
+}
+
+// checkResponse returns an error for unsuccessful responses and how long to wait before a retry if the receiver asks
+// for it. Client errors other than rate limiting are permanent.
+func checkResponse(resp *http.Response, receiver string) (time.Duration, error) {
+	if resp.StatusCode < 300 {
+		return 0, nil
+	}
+
+	err := errors.Errorf("%s responded with status %d", receiver, resp.StatusCode)
+	if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, permanentError{err}
+	}
+
+	return retryAfter(resp), err
+}
+
+// retry calls send until it succeeds or the retries are exhausted. The backoff doubles with every attempt, unless send
+// returns how long to wait.
+func retry(ctx context.Context, retries int, backoff time.Duration, send func() (time.Duration, error)) error {
+	for attempt := 0; ; attempt++ {
+		wait, err := send()
+		if err == nil {
+			return nil
+		}
+		var permanent permanentError
+		if errors.As(err, &permanent) {
+			return err
+		}
+		if attempt >= retries || ctx.Err() != nil {
+			return errors.Wrapf(err, "giving up after %d attempts", attempt+1)
+		}
+
+		if wait == 0 {
+			wait = backoff << attempt
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "giving up after %d attempts", attempt+1)
+		case <-time.After(wait):
+		}
+	}
+}
+
+// retryAfter returns the duration of the Retry-After header of a rate limited response.
+func retryAfter(resp *http.Response) time.Duration {
+	if resp.StatusCode != http.StatusTooManyRequests {
+		return 0
+	}
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+
+	return time.Duration(seconds) * time.Second
+}
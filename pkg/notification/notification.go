@@ -0,0 +1,178 @@
+// Package notification delivers notifications about cluster deletions to channels outside of Kubernetes.
+package notification
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// Kind is the kind of decision a notification is about.
+type Kind string
+
+const (
+	// KindMarked notifies about an upcoming deletion of a cluster.
+	KindMarked Kind = "marked"
+	// KindIgnored notifies about a cluster which is ignored for deletion.
+	KindIgnored Kind = "ignored"
+	// KindDeleted notifies about a cluster which was deleted.
+	KindDeleted Kind = "deleted"
+	// KindFailed notifies about a cluster which could not be deleted.
+	KindFailed Kind = "failed"
+	// KindDigest is the periodic report about all clusters. Its Cluster and Namespace are empty.
+	KindDigest Kind = "digest"
+)
+
+// queueSize is the number of notifications buffered per sink before new notifications are dropped.
+const queueSize = 1000
+
+// Notification describes a decision the controller made about a cluster.
+type Notification struct {
+	Kind      Kind
+	Cluster   string
+	Namespace string
+
+	// Owner is who created the cluster, e.g. a user name or the field manager which created it. It is empty if the
+	// owner is unknown.
+	Owner string
+	// OwnerEmail is the email address of the owner of the cluster. It is empty if the owner is unknown.
+	OwnerEmail string
+	// Organization is the organization the cluster belongs to. It is empty if the cluster has no organization label.
+	Organization string
+
+	// Deadline is when the cluster is going to be deleted. It is zero if the deadline is unknown.
+	Deadline time.Time
+
+	// Reason is a short machine readable reason why a cluster is ignored, e.g. `flux`. It is empty for other kinds.
+	Reason string
+
+	// Message is the human readable description of the decision, the same as in the Kubernetes event.
+	Message string
+
+	// Time is when the decision was made.
+	Time time.Time
+
+	// Digest is the report of a KindDigest notification. It is nil for other kinds.
+	Digest *Digest
+}
+
+// Notifier accepts notifications without blocking the caller.
+type Notifier interface {
+	Notify(n Notification)
+}
+
+// Sink delivers a notification to a single channel, e.g. Slack.
+type Sink interface {
+	// Name identifies the sink in logs.
+	Name() string
+	// Send delivers the notification, retrying if needed. It blocks until the notification is delivered or given up on.
+	Send(ctx context.Context, n Notification) error
+}
+
+// backgroundSink is implemented by sinks which have work to do in the background, e.g. retrying failed notifications.
+type backgroundSink interface {
+	Sink
+	// Run does the background work until the context is cancelled. The logger is passed in the context.
+	Run(ctx context.Context)
+}
+
+// persistentSink is implemented by sinks which store notifications until they are delivered, e.g. on disk. They are
+// stored right away when a notification is dispatched instead of waiting in the in-memory queue of the sink, so they
+// are neither lost on a restart nor dropped when the queue is full.
+type persistentSink interface {
+	Sink
+	// Persist stores the notification for delivery. It does not wait for the delivery.
+	Persist(n Notification) error
+	// Flush delivers the stored notifications.
+	Flush(ctx context.Context) error
+}
+
+// Dispatcher delivers notifications to its sinks in the background, so reconciliations are not slowed down by slow
+// or unavailable sinks. Every sink has its own queue. It implements manager.Runnable.
+type Dispatcher struct {
+	log    logr.Logger
+	sinks  []Sink
+	queues []chan Notification
+}
+
+// NewDispatcher returns a Dispatcher for the given sinks.
+func NewDispatcher(log logr.Logger, sinks ...Sink) *Dispatcher {
+	d := &Dispatcher{
+		log:   log,
+		sinks: sinks,
+	}
+	for _, sink := range sinks {
+		size := queueSize
+		// the queue of a persistent sink only signals that there is something to deliver
+		if _, ok := sink.(persistentSink); ok {
+			size = 1
+		}
+		d.queues = append(d.queues, make(chan Notification, size))
+	}
+
+	return d
+}
+
+// Notify queues the notification for all sinks. It is dropped for sinks whose queue is full, unless the sink persists
+// notifications.
+func (d *Dispatcher) Notify(n Notification) {
+	for i, queue := range d.queues {
+		if persistent, ok := d.sinks[i].(persistentSink); ok {
+			if err := persistent.Persist(n); err != nil {
+				d.log.Error(err, "failed persisting notification", "sink", persistent.Name(), "cluster", n.Namespace+"/"+n.Cluster, "kind", n.Kind)
+				continue
+			}
+			// a full queue means a delivery is pending already, which delivers this notification as well
+			select {
+			case queue <- n:
+			default:
+			}
+			continue
+		}
+
+		select {
+		case queue <- n:
+		default:
+			d.log.Info("Notification queue is full, dropping notification", "sink", d.sinks[i].Name(), "cluster", n.Namespace+"/"+n.Cluster, "kind", n.Kind)
+		}
+	}
+}
+
+// Start delivers queued notifications until the context is cancelled.
+func (d *Dispatcher) Start(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for i, sink := range d.sinks {
+		wg.Go(func() {
+			d.run(ctx, sink, d.queues[i])
+		})
+		if background, ok := sink.(backgroundSink); ok {
+			wg.Go(func() {
+				background.Run(logr.NewContext(ctx, d.log.WithValues("sink", sink.Name())))
+			})
+		}
+	}
+	wg.Wait()
+
+	return nil
+}
+
+func (d *Dispatcher) run(ctx context.Context, sink Sink, queue chan Notification) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-queue:
+			if persistent, ok := sink.(persistentSink); ok {
+				if err := persistent.Flush(ctx); err != nil {
+					d.log.Error(err, "failed delivering persisted notifications", "sink", sink.Name())
+				}
+				continue
+			}
+			if err := sink.Send(ctx, n); err != nil {
+				d.log.Error(err, "failed sending notification", "sink", sink.Name(), "cluster", n.Namespace+"/"+n.Cluster, "kind", n.Kind)
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package notification
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// fileQueue keeps events as one file per event in a directory. The file names start with the time the event was
+// queued, so listing them sorted returns the oldest event first.
+type fileQueue struct {
+	dir string
+	max int
+}
+
+func (q fileQueue) push(event cloudEvent) error {
+	names, err := q.list()
+	if err != nil {
+		return err
+	}
+	if len(names) >= q.max {
+		return errors.Errorf("queue is full with %d notifications, dropping notification for %s", len(names), event.Subject)
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "failed encoding queued notification")
+	}
+	if err := os.MkdirAll(q.dir, 0o700); err != nil {
+		return errors.Wrap(err, "failed creating queue directory")
+	}
+
+	// write to a temporary file first, so a crash never leaves a partial event in the queue
+	name := fmt.Sprintf("%020d-%s.json", time.Now().UnixNano(), event.ID)
+	tmp := filepath.Join(q.dir, "."+name)
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return errors.Wrap(err, "failed writing queued notification")
+	}
+	if err := os.Rename(tmp, filepath.Join(q.dir, name)); err != nil {
+		return errors.Wrap(err, "failed writing queued notification")
+	}
+
+	return nil
+}
+
+// list returns the names of the queued events, oldest first.
+func (q fileQueue) list() ([]string, error) {
+	entries, err := os.ReadDir(q.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed reading queue directory")
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && !strings.HasPrefix(entry.Name(), ".") && strings.HasSuffix(entry.Name(), ".json") {
+			names = append(names, entry.Name())
+		}
+	}
+	slices.Sort(names)
+
+	return names, nil
+}
+
+// read returns the queued event. Events which can not be decoded are never going to be delivered, the error is
+// permanent.
+func (q fileQueue) read(name string) (cloudEvent, error) {
+	data, err := os.ReadFile(filepath.Join(q.dir, name))
+	if err != nil {
+		return cloudEvent{}, errors.Wrap(err, "failed reading queued notification")
+	}
+
+	var event cloudEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return cloudEvent{}, permanentError{errors.Wrap(err, "failed decoding queued notification")}
+	}
+
+	return event, nil
+}
+
+func (q fileQueue) remove(name string) error {
+	if err := os.Remove(filepath.Join(q.dir, name)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "failed removing queued notification")
+	}
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+)
+
+// defaultSlackRateLimit is the default number of messages per minute, Slack allows about one per second.
+const defaultSlackRateLimit = 60
+
+// SlackConfig configures the Slack sink.
+type SlackConfig struct {
+	// WebhookURL is the Slack incoming webhook for clusters in namespaces without a route. Notifications for such
+	// clusters are not sent if it is empty.
+	WebhookURL string `json:"webhookURL,omitempty"`
+
+	// Namespaces routes the notifications for clusters in a namespace to the incoming webhook of another channel.
+	Namespaces map[string]string `json:"namespaces,omitempty"`
+
+	// RateLimit is the maximum number of messages sent per minute. Defaults to 60.
+	RateLimit int `json:"rateLimit,omitempty"`
+
+	// Retries is how often a failed message is retried. Defaults to 3.
+	Retries *int `json:"retries,omitempty"`
+}
+
+func (c SlackConfig) validate() error {
+	if c.WebhookURL != "" {
+		if err := validateURL(c.WebhookURL); err != nil {
+			return errors.Wrap(err, "webhookURL")
+		}
+	}
+	for namespace, webhookURL := range c.Namespaces {
+		if err := validateURL(webhookURL); err != nil {
+			return errors.Wrapf(err, "namespaces[%s]", namespace)
+		}
+	}
+	if c.RateLimit < 0 {
+		return errors.New("rateLimit must not be negative")
+	}
+	if c.Retries != nil && *c.Retries < 0 {
+		return errors.New("retries must not be negative")
+	}
+
+	return nil
+}
+
+// SlackSink posts notifications to Slack incoming webhooks.
+type SlackSink struct {
+	client     *http.Client
+	webhookURL string
+	namespaces map[string]string
+	limiter    *rate.Limiter
+	retries    int
+	backoff    time.Duration
+}
+
+// NewSlackSink returns a SlackSink for the given config.
+func NewSlackSink(c SlackConfig) *SlackSink {
+	rateLimit := c.RateLimit
+	if rateLimit == 0 {
+		rateLimit = defaultSlackRateLimit
+	}
+	retries := defaultRetries
+	if c.Retries != nil {
+		retries = *c.Retries
+	}
+
+	return &SlackSink{
+		client:     &http.Client{Timeout: requestTimeout},
+		webhookURL: c.WebhookURL,
+		namespaces: c.Namespaces,
+		limiter:    rate.NewLimiter(rate.Limit(float64(rateLimit)/60), 1),
+		retries:    retries,
+		backoff:    defaultBackoff,
+	}
+}
+
+// Name returns the name of the sink.
+func (s *SlackSink) Name() string {
+	return "slack"
+}
+
+// Send posts the notification to the incoming webhook of the namespace of the cluster. Ignored clusters are not
+// reported, Slack is meant for the people who are about to lose a cluster. Digests are posted to the default webhook
+// as Markdown.
+func (s *SlackSink) Send(ctx context.Context, n Notification) error {
+	if n.Kind == KindIgnored {
+		return nil
+	}
+
+	webhookURL, ok := s.namespaces[n.Namespace]
+	if !ok || n.Kind == KindDigest {
+		webhookURL = s.webhookURL
+	}
+	if webhookURL == "" {
+		return nil
+	}
+
+	body, err := json.Marshal(slackMessage(n))
+	if err != nil {
+		return errors.Wrap(err, "failed encoding slack message")
+	}
+
+	return retry(ctx, s.retries, s.backoff, func() (time.Duration, error) {
+		if err := s.limiter.Wait(ctx); err != nil {
+			return 0, err
+		}
+		return s.post(ctx, webhookURL, body)
+	})
+}
+
+// post sends a single request. It returns how long to wait before a retry if Slack asks for it.
+func (s *SlackSink) post(ctx context.Context, webhookURL string, body []byte) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, errors.New("failed creating slack request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		// the error contains the webhook url, which is a secret
+		return 0, errors.New("failed sending slack request")
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	return checkResponse(resp, "slack")
+}
+
+// slackMessage returns the message posted for the notification. Digests are sent as markdown block, with their
+// summary as fallback text.
+func slackMessage(n Notification) map[string]any {
+	if n.Kind == KindDigest && n.Digest != nil {
+		return map[string]any{
+			"text": ":calendar: " + n.Digest.Summary(),
+			"blocks": []map[string]string{
+				{"type": "markdown", "text": n.Digest.Markdown()},
+			},
+		}
+	}
+
+	return map[string]any{"text": slackText(n)}
+}
+
+func slackText(n Notification) string {
+	icon := ":information_source:"
+	switch n.Kind {
+	case KindMarked:
+		icon = ":warning:"
+	case KindDeleted:
+		icon = ":wastebasket:"
+	case KindFailed:
+		icon = ":x:"
+	}
+
+	if n.Owner != "" {
+		return fmt.Sprintf("%s Cluster `%s/%s` of %s: %s", icon, n.Namespace, n.Cluster, n.Owner, n.Message)
+	}
+
+	return fmt.Sprintf("%s Cluster `%s/%s`: %s", icon, n.Namespace, n.Cluster, n.Message)
+}
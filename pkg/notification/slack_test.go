@@ -0,0 +1,278 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+// slackServer is a stand-in for a Slack incoming webhook. It answers with the given status codes in order and with
+// 200 once they are used up.
+type slackServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	requests []string
+	times    []time.Time
+}
+
+func newSlackServer(t *testing.T, statuses ...int) *slackServer {
+	s := &slackServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message struct {
+			Text   string              `json:"text"`
+			Blocks []map[string]string `json:"blocks"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+			t.Errorf("failed decoding slack message: %v", err)
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.requests = append(s.requests, r.URL.Path+" "+message.Text)
+		for _, block := range message.Blocks {
+			s.requests = append(s.requests, r.URL.Path+" "+block["type"]+" "+block["text"])
+		}
+		s.times = append(s.times, time.Now())
+		status := http.StatusOK
+		if len(s.statuses) > 0 {
+			status, s.statuses = s.statuses[0], s.statuses[1:]
+		}
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "0")
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *slackServer) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.requests...)
+}
+
+func newTestSlackSink(c SlackConfig) *SlackSink {
+	s := NewSlackSink(c)
+	s.backoff = time.Millisecond
+	s.limiter = rate.NewLimiter(rate.Inf, 1)
+
+	return s
+}
+
+func TestSlackSink(t *testing.T) {
+	marked := Notification{Kind: KindMarked, Cluster: "test", Namespace: "org-test", Message: "Cluster will be deleted in aprox. 60 min."}
+	deleted := Notification{Kind: KindDeleted, Cluster: "test", Namespace: "org-other", Message: "Cluster was deleted."}
+	digest := newTestDigest()
+
+	testCases := []struct {
+		name             string
+		namespaces       map[string]string
+		noDefault        bool
+		statuses         []int
+		notification     Notification
+		expectedRequests []string
+		expectedError    bool
+	}{
+		{
+			name:             "case 0 - default webhook",
+			notification:     marked,
+			expectedRequests: []string{"/default :warning: Cluster `org-test/test`: Cluster will be deleted in aprox. 60 min."},
+		},
+		{
+			name:             "case 1 - routed by namespace",
+			namespaces:       map[string]string{"org-test": "/test"},
+			notification:     marked,
+			expectedRequests: []string{"/test :warning: Cluster `org-test/test`: Cluster will be deleted in aprox. 60 min."},
+		},
+		{
+			name:             "case 2 - other namespace uses the default webhook",
+			namespaces:       map[string]string{"org-test": "/test"},
+			notification:     deleted,
+			expectedRequests: []string{"/default :wastebasket: Cluster `org-other/test`: Cluster was deleted."},
+		},
+		{
+			name:         "case 3 - no route and no default webhook",
+			namespaces:   map[string]string{"org-test": "/test"},
+			noDefault:    true,
+			notification: deleted,
+		},
+		{
+			name:         "case 4 - retried after server errors",
+			statuses:     []int{http.StatusInternalServerError, http.StatusTooManyRequests},
+			notification: deleted,
+			expectedRequests: []string{
+				"/default :wastebasket: Cluster `org-other/test`: Cluster was deleted.",
+				"/default :wastebasket: Cluster `org-other/test`: Cluster was deleted.",
+				"/default :wastebasket: Cluster `org-other/test`: Cluster was deleted.",
+			},
+		},
+		{
+			name:             "case 5 - client errors are not retried",
+			statuses:         []int{http.StatusBadRequest},
+			notification:     deleted,
+			expectedRequests: []string{"/default :wastebasket: Cluster `org-other/test`: Cluster was deleted."},
+			expectedError:    true,
+		},
+		{
+			name:          "case 6 - retries exhausted",
+			statuses:      []int{500, 500, 500, 500},
+			notification:  deleted,
+			expectedError: true,
+			expectedRequests: []string{
+				"/default :wastebasket: Cluster `org-other/test`: Cluster was deleted.",
+				"/default :wastebasket: Cluster `org-other/test`: Cluster was deleted.",
+				"/default :wastebasket: Cluster `org-other/test`: Cluster was deleted.",
+				"/default :wastebasket: Cluster `org-other/test`: Cluster was deleted.",
+			},
+		},
+		{
+			name:         "case 7 - ignored clusters are not reported",
+			notification: Notification{Kind: KindIgnored, Cluster: "test", Namespace: "org-test", Reason: "flux"},
+		},
+		{
+			name:         "case 8 - digest to the default webhook",
+			namespaces:   map[string]string{"org-test": "/test"},
+			notification: Notification{Kind: KindDigest, Digest: &digest},
+			expectedRequests: []string{
+				"/default :calendar: " + digest.Summary(),
+				"/default markdown " + digest.Markdown(),
+			},
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			server := newSlackServer(t, tc.statuses...)
+
+			config := SlackConfig{Namespaces: map[string]string{}}
+			if !tc.noDefault {
+				config.WebhookURL = server.URL + "/default"
+			}
+			for namespace, path := range tc.namespaces {
+				config.Namespaces[namespace] = server.URL + path
+			}
+
+			err := newTestSlackSink(config).Send(context.TODO(), tc.notification)
+			if tc.expectedError {
+				assert.Error(t, err, "test case %v failed.", tc.name)
+			} else {
+				assert.NoError(t, err, "test case %v failed.", tc.name)
+			}
+			assert.Equal(t, tc.expectedRequests, server.received(), "test case %v failed.", tc.name)
+		})
+	}
+}
+
+func TestSlackSinkRateLimit(t *testing.T) {
+	server := newSlackServer(t)
+	// 1200 messages per minute are one every 50ms
+	sink := NewSlackSink(SlackConfig{WebhookURL: server.URL, RateLimit: 1200})
+
+	for range 3 {
+		if err := sink.Send(context.TODO(), Notification{Kind: KindMarked, Cluster: "test", Namespace: "default"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	assert.Len(t, server.times, 3)
+	assert.GreaterOrEqual(t, server.times[2].Sub(server.times[0]), 90*time.Millisecond)
+}
+
+func TestSlackConfig(t *testing.T) {
+	negative := -1
+
+	testCases := []struct {
+		name          string
+		config        SlackConfig
+		expectedError bool
+	}{
+		{
+			name:   "case 0 - valid",
+			config: SlackConfig{WebhookURL: "https://hooks.slack.com/services/a/b/c", Namespaces: map[string]string{"org-test": "https://hooks.slack.com/services/d/e/f"}},
+		},
+		{
+			name:   "case 1 - only namespace routes",
+			config: SlackConfig{Namespaces: map[string]string{"org-test": "https://hooks.slack.com/services/d/e/f"}},
+		},
+		{
+			name:          "case 2 - invalid scheme",
+			config:        SlackConfig{WebhookURL: "ftp://hooks.slack.com/services/a/b/c"},
+			expectedError: true,
+		},
+		{
+			name:          "case 3 - invalid namespace route",
+			config:        SlackConfig{Namespaces: map[string]string{"org-test": "hooks.slack.com"}},
+			expectedError: true,
+		},
+		{
+			name:          "case 4 - negative retries",
+			config:        SlackConfig{WebhookURL: "https://hooks.slack.com/services/a/b/c", Retries: &negative},
+			expectedError: true,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			err := tc.config.validate()
+			if tc.expectedError {
+				assert.Error(t, err, "test case %v failed.", tc.name)
+			} else {
+				assert.NoError(t, err, "test case %v failed.", tc.name)
+			}
+		})
+	}
+}
+
+// recordingSink records all notifications it receives.
+type recordingSink struct {
+	received chan Notification
+}
+
+func (s *recordingSink) Name() string {
+	return "recording"
+}
+
+func (s *recordingSink) Send(_ context.Context, n Notification) error {
+	s.received <- n
+	return nil
+}
+
+func TestDispatcher(t *testing.T) {
+	first := &recordingSink{received: make(chan Notification, 1)}
+	second := &recordingSink{received: make(chan Notification, 1)}
+	dispatcher := NewDispatcher(logr.Discard(), first, second)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	done := make(chan error)
+	go func() {
+		done <- dispatcher.Start(ctx)
+	}()
+
+	n := Notification{Kind: KindDeleted, Cluster: "test", Namespace: "default"}
+	dispatcher.Notify(n)
+	for _, sink := range []*recordingSink{first, second} {
+		select {
+		case received := <-sink.received:
+			assert.Equal(t, n, received)
+		case <-time.After(5 * time.Second):
+			t.Fatal("notification was not delivered")
+		}
+	}
+
+	cancel()
+	assert.NoError(t, <-done)
+}
@@ -0,0 +1,340 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+const (
+	// SignatureHeader contains the HMAC-SHA256 signature of the request body, e.g. `sha256=<hex>`.
+	SignatureHeader = "X-Cluster-Cleaner-Signature"
+
+	// EventTypePrefix is the prefix of the CloudEvents type, followed by the kind, e.g.
+	// `io.giantswarm.cluster-cleaner.cluster.deleted`.
+	EventTypePrefix = "io.giantswarm.cluster-cleaner.cluster."
+
+	cloudEventsContentType = "application/cloudevents+json"
+	defaultWebhookSource   = "cluster-cleaner"
+	defaultMaxQueued       = 1000
+	queueRetryInterval     = time.Minute
+)
+
+// WebhookEndpoint is a receiver of webhook notifications.
+type WebhookEndpoint struct {
+	// URL the notifications are posted to.
+	URL string `json:"url,omitempty"`
+
+	// Secret is the key of the HMAC-SHA256 signature in the X-Cluster-Cleaner-Signature header. Requests are not
+	// signed if it is empty.
+	Secret string `json:"secret,omitempty"`
+}
+
+// WebhookConfig configures the webhook sink.
+type WebhookConfig struct {
+	// WebhookEndpoint receives the notifications for clusters in namespaces without a route. Notifications for such
+	// clusters are not sent if its URL is empty.
+	WebhookEndpoint
+
+	// Namespaces routes the notifications for clusters in a namespace to another endpoint.
+	Namespaces map[string]WebhookEndpoint `json:"namespaces,omitempty"`
+
+	// Source is the CloudEvents source, e.g. the name of the management cluster. Defaults to cluster-cleaner.
+	Source string `json:"source,omitempty"`
+
+	// QueueDir is the directory notifications are kept in until they are delivered, so they survive restarts.
+	QueueDir string `json:"queueDir"`
+
+	// MaxQueued is the maximum number of undelivered notifications. Defaults to 1000.
+	MaxQueued int `json:"maxQueued,omitempty"`
+
+	// Retries is how often a failed notification is retried before it is left in the queue. Defaults to 3.
+	Retries *int `json:"retries,omitempty"`
+}
+
+func (c WebhookConfig) validate() error {
+	if c.URL != "" {
+		if err := validateURL(c.URL); err != nil {
+			return errors.Wrap(err, "url")
+		}
+	}
+	for namespace, endpoint := range c.Namespaces {
+		if err := validateURL(endpoint.URL); err != nil {
+			return errors.Wrapf(err, "namespaces[%s].url", namespace)
+		}
+	}
+	if c.QueueDir == "" {
+		return errors.New("queueDir must be set")
+	}
+	if c.MaxQueued < 0 {
+		return errors.New("maxQueued must not be negative")
+	}
+	if c.Retries != nil && *c.Retries < 0 {
+		return errors.New("retries must not be negative")
+	}
+
+	return nil
+}
+
+// cloudEvent is a CloudEvents 1.0 event in structured content mode.
+type cloudEvent struct {
+	SpecVersion     string    `json:"specversion"`
+	ID              string    `json:"id"`
+	Source          string    `json:"source"`
+	Type            string    `json:"type"`
+	Subject         string    `json:"subject,omitempty"`
+	Time            time.Time `json:"time"`
+	DataContentType string    `json:"datacontenttype"`
+	Data            eventData `json:"data"`
+}
+
+// eventData is the data of an event. Digests have no cluster and namespace, but the digest.
+type eventData struct {
+	Cluster      string     `json:"cluster,omitempty"`
+	Namespace    string     `json:"namespace,omitempty"`
+	Owner        string     `json:"owner,omitempty"`
+	OwnerEmail   string     `json:"ownerEmail,omitempty"`
+	Organization string     `json:"organization,omitempty"`
+	Deadline     *time.Time `json:"deadline,omitempty"`
+	Reason       string     `json:"reason,omitempty"`
+	Message      string     `json:"message"`
+	Digest       *Digest    `json:"digest,omitempty"`
+}
+
+// WebhookSink posts notifications as CloudEvents to HTTP endpoints. Notifications are queued on disk before they are
+// delivered and retried in the background until the endpoint accepts or permanently rejects them.
+type WebhookSink struct {
+	client        *http.Client
+	endpoint      WebhookEndpoint
+	namespaces    map[string]WebhookEndpoint
+	source        string
+	queue         fileQueue
+	retries       int
+	backoff       time.Duration
+	retryInterval time.Duration
+
+	// mu serializes deliveries, so the queue is delivered in order.
+	mu sync.Mutex
+}
+
+// NewWebhookSink returns a WebhookSink for the given config.
+func NewWebhookSink(c WebhookConfig) *WebhookSink {
+	source := c.Source
+	if source == "" {
+		source = defaultWebhookSource
+	}
+	maxQueued := c.MaxQueued
+	if maxQueued == 0 {
+		maxQueued = defaultMaxQueued
+	}
+	retries := defaultRetries
+	if c.Retries != nil {
+		retries = *c.Retries
+	}
+
+	return &WebhookSink{
+		client:        &http.Client{Timeout: requestTimeout},
+		endpoint:      c.WebhookEndpoint,
+		namespaces:    c.Namespaces,
+		source:        source,
+		queue:         fileQueue{dir: c.QueueDir, max: maxQueued},
+		retries:       retries,
+		backoff:       defaultBackoff,
+		retryInterval: queueRetryInterval,
+	}
+}
+
+// Name returns the name of the sink.
+func (s *WebhookSink) Name() string {
+	return "webhook"
+}
+
+// Send queues the notification and delivers all queued notifications in order. Notifications which can not be
+// delivered yet stay in the queue. Digests are sent to the default endpoint.
+func (s *WebhookSink) Send(ctx context.Context, n Notification) error {
+	if err := s.Persist(n); err != nil {
+		return err
+	}
+
+	return s.Flush(ctx)
+}
+
+// Persist queues the notification on disk without delivering it. The queue is safe to push to while it is delivered,
+// as every notification is written to its own file.
+func (s *WebhookSink) Persist(n Notification) error {
+	if s.endpointFor(n.Namespace).URL == "" {
+		return nil
+	}
+
+	return s.queue.push(s.newEvent(n))
+}
+
+// Flush delivers all queued notifications in order.
+func (s *WebhookSink) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.deliverQueued(ctx)
+}
+
+// Run delivers the notifications left in the queue, e.g. from before a restart, and retries them periodically.
+func (s *WebhookSink) Run(ctx context.Context) {
+	log := logr.FromContextOrDiscard(ctx)
+	ticker := time.NewTicker(s.retryInterval)
+	defer ticker.Stop()
+
+	for {
+		err := s.Flush(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Error(err, "failed delivering queued notifications")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverQueued delivers the queued notifications, oldest first. Once a notification can not be delivered yet, the
+// later notifications for the same endpoint stay in the queue to keep their order, while the notifications for the
+// other endpoints are still delivered. Notifications which are rejected permanently are dropped.
+func (s *WebhookSink) deliverQueued(ctx context.Context) error {
+	names, err := s.queue.list()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	unavailable := map[string]bool{}
+	for _, name := range names {
+		if ctx.Err() != nil {
+			errs = append(errs, ctx.Err())
+			break
+		}
+
+		event, err := s.queue.read(name)
+		var permanent permanentError
+		if err != nil && !errors.As(err, &permanent) {
+			return err
+		}
+		if err == nil {
+			url := s.endpointFor(event.Data.Namespace).URL
+			if unavailable[url] {
+				continue
+			}
+			err = s.deliver(ctx, event)
+			if err != nil && !errors.As(err, &permanent) {
+				unavailable[url] = true
+				errs = append(errs, errors.Wrapf(err, "kept notification %s", name))
+				continue
+			}
+		}
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "dropped notification %s", name))
+		}
+		if err := s.queue.remove(name); err != nil {
+			return err
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// deliver posts the event with retries. Errors which are not going to go away with a retry are permanent.
+func (s *WebhookSink) deliver(ctx context.Context, event cloudEvent) error {
+	endpoint := s.endpointFor(event.Data.Namespace)
+	if endpoint.URL == "" {
+		return permanentError{errors.Errorf("no endpoint for namespace %s", event.Data.Namespace)}
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return permanentError{errors.Wrap(err, "failed encoding cloud event")}
+	}
+
+	return retry(ctx, s.retries, s.backoff, func() (time.Duration, error) {
+		return s.post(ctx, endpoint, body)
+	})
+}
+
+// post sends a single request. It returns how long to wait before a retry if the endpoint asks for it.
+func (s *WebhookSink) post(ctx context.Context, endpoint WebhookEndpoint, body []byte) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, permanentError{errors.New("failed creating webhook request")}
+	}
+	req.Header.Set("Content-Type", cloudEventsContentType)
+	if endpoint.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(endpoint.Secret, body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		// the error contains the url, which may contain a secret
+		return 0, errors.New("failed sending webhook request")
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	return checkResponse(resp, "webhook")
+}
+
+func (s *WebhookSink) endpointFor(namespace string) WebhookEndpoint {
+	if endpoint, ok := s.namespaces[namespace]; ok {
+		return endpoint
+	}
+
+	return s.endpoint
+}
+
+func (s *WebhookSink) newEvent(n Notification) cloudEvent {
+	event := cloudEvent{
+		SpecVersion:     "1.0",
+		ID:              uuid.NewString(),
+		Source:          s.source,
+		Type:            EventTypePrefix + string(n.Kind),
+		Time:            n.Time.UTC(),
+		DataContentType: "application/json",
+		Data: eventData{
+			Cluster:      n.Cluster,
+			Namespace:    n.Namespace,
+			Owner:        n.Owner,
+			OwnerEmail:   n.OwnerEmail,
+			Organization: n.Organization,
+			Reason:       n.Reason,
+			Message:      n.Message,
+			Digest:       n.Digest,
+		},
+	}
+	if n.Cluster != "" {
+		event.Subject = n.Namespace + "/" + n.Cluster
+	}
+	if !n.Deadline.IsZero() {
+		deadline := n.Deadline.UTC()
+		event.Data.Deadline = &deadline
+	}
+
+	return event
+}
+
+// Sign returns the value of the signature header for the body, so receivers can verify it with hmac.Equal.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,379 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+)
+
+type webhookRequest struct {
+	path      string
+	signature string
+	event     cloudEvent
+	body      []byte
+}
+
+// webhookServer is a stand-in for a webhook receiver. It answers with the given status codes in order and with 200
+// once they are used up.
+type webhookServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	requests []webhookRequest
+}
+
+func newWebhookServer(t *testing.T, statuses ...int) *webhookServer {
+	s := &webhookServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("failed reading webhook request: %v", err)
+		}
+		if r.Header.Get("Content-Type") != cloudEventsContentType {
+			t.Errorf("unexpected content type %q", r.Header.Get("Content-Type"))
+		}
+		request := webhookRequest{path: r.URL.Path, signature: r.Header.Get(SignatureHeader), body: body}
+		if err := json.Unmarshal(body, &request.event); err != nil {
+			t.Errorf("failed decoding cloud event: %v", err)
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		status := http.StatusOK
+		if len(s.statuses) > 0 {
+			status, s.statuses = s.statuses[0], s.statuses[1:]
+		}
+		if status < 300 {
+			s.requests = append(s.requests, request)
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *webhookServer) delivered() []webhookRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]webhookRequest(nil), s.requests...)
+}
+
+func newTestWebhookSink(c WebhookConfig) *WebhookSink {
+	s := NewWebhookSink(c)
+	s.backoff = time.Millisecond
+
+	return s
+}
+
+func TestWebhookSink(t *testing.T) {
+	now := time.Date(2022, 2, 1, 12, 0, 0, 0, time.UTC)
+	deadline := now.Add(time.Hour)
+
+	testCases := []struct {
+		name              string
+		namespace         string
+		statuses          []int
+		expectedPath      string
+		expectedSecret    string
+		expectedDelivered bool
+		expectedError     bool
+		expectedQueued    int
+	}{
+		{
+			name:              "case 0 - default endpoint",
+			namespace:         "default",
+			expectedPath:      "/default",
+			expectedSecret:    "default-secret",
+			expectedDelivered: true,
+		},
+		{
+			name:              "case 1 - routed by namespace",
+			namespace:         "org-test",
+			expectedPath:      "/test",
+			expectedSecret:    "test-secret",
+			expectedDelivered: true,
+		},
+		{
+			name:              "case 2 - unsigned endpoint",
+			namespace:         "org-unsigned",
+			expectedPath:      "/unsigned",
+			expectedDelivered: true,
+		},
+		{
+			name:              "case 3 - retried after server errors",
+			namespace:         "default",
+			statuses:          []int{http.StatusInternalServerError, http.StatusBadGateway},
+			expectedPath:      "/default",
+			expectedSecret:    "default-secret",
+			expectedDelivered: true,
+		},
+		{
+			name:          "case 4 - rejected events are dropped",
+			namespace:     "default",
+			statuses:      []int{http.StatusBadRequest},
+			expectedError: true,
+		},
+		{
+			name:           "case 5 - kept in the queue when retries are exhausted",
+			namespace:      "default",
+			statuses:       []int{500, 500, 500, 500},
+			expectedError:  true,
+			expectedQueued: 1,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			server := newWebhookServer(t, tc.statuses...)
+			queueDir := t.TempDir()
+			sink := newTestWebhookSink(WebhookConfig{
+				WebhookEndpoint: WebhookEndpoint{URL: server.URL + "/default", Secret: "default-secret"},
+				Namespaces: map[string]WebhookEndpoint{
+					"org-test":     {URL: server.URL + "/test", Secret: "test-secret"},
+					"org-unsigned": {URL: server.URL + "/unsigned"},
+				},
+				Source:   "test-installation",
+				QueueDir: queueDir,
+			})
+
+			err := sink.Send(context.TODO(), Notification{
+				Kind:      KindMarked,
+				Cluster:   "test",
+				Namespace: tc.namespace,
+				Deadline:  deadline,
+				Message:   "Cluster will be deleted in aprox. 60 min.",
+				Time:      now,
+			})
+			if tc.expectedError {
+				assert.Error(t, err, "test case %v failed.", tc.name)
+			} else {
+				assert.NoError(t, err, "test case %v failed.", tc.name)
+			}
+
+			queued, err := sink.queue.list()
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Len(t, queued, tc.expectedQueued, "test case %v failed.", tc.name)
+
+			delivered := server.delivered()
+			if !tc.expectedDelivered {
+				assert.Empty(t, delivered, "test case %v failed.", tc.name)
+				return
+			}
+			if !assert.Len(t, delivered, 1, "test case %v failed.", tc.name) {
+				return
+			}
+			request := delivered[0]
+			assert.Equal(t, tc.expectedPath, request.path, "test case %v failed.", tc.name)
+			if tc.expectedSecret != "" {
+				assert.Equal(t, Sign(tc.expectedSecret, request.body), request.signature, "test case %v failed.", tc.name)
+			} else {
+				assert.Empty(t, request.signature, "test case %v failed.", tc.name)
+			}
+
+			event := request.event
+			assert.Equal(t, "1.0", event.SpecVersion)
+			assert.NotEmpty(t, event.ID)
+			assert.Equal(t, "test-installation", event.Source)
+			assert.Equal(t, "io.giantswarm.cluster-cleaner.cluster.marked", event.Type)
+			assert.Equal(t, tc.namespace+"/test", event.Subject)
+			assert.Equal(t, now, event.Time)
+			assert.Equal(t, eventData{
+				Cluster:   "test",
+				Namespace: tc.namespace,
+				Deadline:  &deadline,
+				Message:   "Cluster will be deleted in aprox. 60 min.",
+			}, event.Data)
+		})
+	}
+}
+
+func TestWebhookSinkQueueSurvivesRestart(t *testing.T) {
+	queueDir := t.TempDir()
+	n := Notification{Kind: KindDeleted, Cluster: "test", Namespace: "default", Message: "Cluster was deleted."}
+
+	// the endpoint is unavailable until the controller is restarted
+	unavailable := newWebhookServer(t, 500, 500, 500, 500, 500, 500, 500, 500)
+	sink := newTestWebhookSink(WebhookConfig{WebhookEndpoint: WebhookEndpoint{URL: unavailable.URL}, QueueDir: queueDir})
+	assert.Error(t, sink.Send(context.TODO(), n))
+	n.Cluster = "other"
+	assert.Error(t, sink.Send(context.TODO(), n))
+
+	available := newWebhookServer(t)
+	restarted := newTestWebhookSink(WebhookConfig{WebhookEndpoint: WebhookEndpoint{URL: available.URL}, QueueDir: queueDir})
+	ctx, cancel := context.WithCancel(logr.NewContext(context.TODO(), logr.Discard()))
+	done := make(chan struct{})
+	go func() {
+		restarted.Run(ctx)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool {
+		return len(available.delivered()) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+
+	delivered := available.delivered()
+	assert.Equal(t, "default/test", delivered[0].event.Subject)
+	assert.Equal(t, "default/other", delivered[1].event.Subject)
+	queued, err := restarted.queue.list()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, queued)
+}
+
+func TestWebhookSinkUnavailableEndpoint(t *testing.T) {
+	// the endpoint for org-down never accepts events, the default endpoint is available
+	down := newWebhookServer(t, 500, 500, 500, 500, 500, 500, 500, 500, 500, 500, 500, 500)
+	available := newWebhookServer(t)
+	sink := newTestWebhookSink(WebhookConfig{
+		WebhookEndpoint: WebhookEndpoint{URL: available.URL},
+		Namespaces: map[string]WebhookEndpoint{
+			"org-down": {URL: down.URL},
+		},
+		QueueDir: t.TempDir(),
+	})
+
+	for _, n := range []Notification{
+		{Kind: KindDeleted, Cluster: "first", Namespace: "org-down"},
+		{Kind: KindDeleted, Cluster: "second", Namespace: "org-down"},
+		{Kind: KindDeleted, Cluster: "first", Namespace: "default"},
+		{Kind: KindDeleted, Cluster: "second", Namespace: "default"},
+	} {
+		assert.NoError(t, sink.Persist(n))
+	}
+	assert.Error(t, sink.Flush(context.TODO()))
+
+	delivered := available.delivered()
+	if assert.Len(t, delivered, 2) {
+		assert.Equal(t, "default/first", delivered[0].event.Subject)
+		assert.Equal(t, "default/second", delivered[1].event.Subject)
+	}
+	// the unavailable endpoint is only tried once per flush, its events are kept in order
+	assert.Empty(t, down.delivered())
+	down.mu.Lock()
+	assert.Len(t, down.statuses, 8)
+	down.mu.Unlock()
+
+	queued, err := sink.queue.list()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, queued, 2) {
+		for i, cluster := range []string{"first", "second"} {
+			event, err := sink.queue.read(queued[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, "org-down/"+cluster, event.Subject)
+		}
+	}
+}
+
+func TestDispatcherPersistsWebhookNotifications(t *testing.T) {
+	queueDir := t.TempDir()
+	server := newWebhookServer(t)
+	sink := newTestWebhookSink(WebhookConfig{
+		WebhookEndpoint: WebhookEndpoint{URL: server.URL},
+		QueueDir:        queueDir,
+		MaxQueued:       2 * queueSize,
+	})
+	dispatcher := NewDispatcher(logr.Discard(), sink)
+
+	// the notifications are on disk before the dispatcher is started, even more than fit into its in-memory queue
+	n := Notification{Kind: KindDeleted, Cluster: "test", Namespace: "default"}
+	for range queueSize + 1 {
+		dispatcher.Notify(n)
+	}
+	queued, err := sink.queue.list()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, queued, queueSize+1)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	done := make(chan error)
+	go func() {
+		done <- dispatcher.Start(ctx)
+	}()
+	assert.Eventually(t, func() bool {
+		return len(server.delivered()) == queueSize+1
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestWebhookSinkQueueLimit(t *testing.T) {
+	server := newWebhookServer(t, 500, 500)
+	retries := 0
+	sink := newTestWebhookSink(WebhookConfig{
+		WebhookEndpoint: WebhookEndpoint{URL: server.URL},
+		QueueDir:        t.TempDir(),
+		MaxQueued:       1,
+		Retries:         &retries,
+	})
+
+	n := Notification{Kind: KindDeleted, Cluster: "test", Namespace: "default"}
+	assert.Error(t, sink.Send(context.TODO(), n))
+	assert.ErrorContains(t, sink.Send(context.TODO(), n), "queue is full")
+
+	queued, err := sink.queue.list()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, queued, 1)
+}
+
+func TestWebhookConfig(t *testing.T) {
+	testCases := []struct {
+		name          string
+		config        WebhookConfig
+		expectedError bool
+	}{
+		{
+			name: "case 0 - valid",
+			config: WebhookConfig{
+				WebhookEndpoint: WebhookEndpoint{URL: "https://ci.example.com/hooks/cluster-cleaner", Secret: "secret"},
+				Namespaces:      map[string]WebhookEndpoint{"org-test": {URL: "https://bot.example.com/hooks"}},
+				QueueDir:        "/var/lib/cluster-cleaner",
+			},
+		},
+		{
+			name:          "case 1 - missing queue directory",
+			config:        WebhookConfig{WebhookEndpoint: WebhookEndpoint{URL: "https://ci.example.com/hooks/cluster-cleaner"}},
+			expectedError: true,
+		},
+		{
+			name: "case 2 - namespace without url",
+			config: WebhookConfig{
+				Namespaces: map[string]WebhookEndpoint{"org-test": {Secret: "secret"}},
+				QueueDir:   "/var/lib/cluster-cleaner",
+			},
+			expectedError: true,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			err := tc.config.validate()
+			if tc.expectedError {
+				assert.Error(t, err, "test case %v failed.", tc.name)
+			} else {
+				assert.NoError(t, err, "test case %v failed.", tc.name)
+			}
+		})
+	}
+}
@@ -0,0 +1,326 @@
+package policy
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	capi "sigs.k8s.io/cluster-api/api/core/v1beta2"
+)
+
+// CreationTime returns when the cluster was created in UTC.
+func CreationTime(cluster *capi.Cluster) time.Time {
+	return cluster.CreationTimestamp.UTC()
+}
+
+// TTL returns the time to live set on the cluster. The annotation takes precedence over the label.
+func TTL(cluster *capi.Cluster) (time.Duration, bool, error) {
+	v, ok := cluster.Annotations[ClusterTTL]
+	if !ok {
+		v, ok = cluster.Labels[ClusterTTL]
+	}
+	if !ok {
+		return 0, false, nil
+	}
+
+	ttl, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, false, errors.Wrapf(err, "failed to parse %s value %q", ClusterTTL, v)
+	}
+	if ttl <= 0 {
+		return 0, false, errors.Errorf("%s value %q must be positive", ClusterTTL, v)
+	}
+
+	return ttl, true, nil
+}
+
+// KeepUntil returns the point in time until which the cluster is kept and the label or annotation it was read from.
+// The annotation takes precedence over the label. An empty source means the cluster has no `keep-until` setting.
+func KeepUntil(cluster *capi.Cluster) (time.Time, string, error) {
+	if t, ok, err := KeepUntilFromAnnotation(cluster); ok {
+		return t, KeepUntilAnnotation, err
+	}
+	if t, ok, err := KeepUntilFromLabel(cluster); ok {
+		return t, KeepUntilLabel, err
+	}
+
+	return time.Time{}, "", nil
+}
+
+// KeepUntilFromAnnotation returns the point in time of the `keep-until` annotation and whether the cluster has it.
+func KeepUntilFromAnnotation(cluster *capi.Cluster) (time.Time, bool, error) {
+	v, ok := cluster.Annotations[KeepUntilAnnotation]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+
+	loc := time.UTC
+	if tz, ok := cluster.Annotations[KeepUntilTimezoneAnnotation]; ok {
+		var err error
+		loc, err = time.LoadLocation(tz)
+		if err != nil {
+			return time.Time{}, true, errors.Wrapf(err, "failed to load time zone %q from %s", tz, KeepUntilTimezoneAnnotation)
+		}
+	}
+
+	t, err := parseKeepUntilTimestamp(v, loc)
+	if err != nil {
+		return time.Time{}, true, err
+	}
+
+	return t, true, nil
+}
+
+// KeepUntilFromLabel returns the end of the date of the `keep-until` label and whether the cluster has it.
+func KeepUntilFromLabel(cluster *capi.Cluster) (time.Time, bool, error) {
+	v, ok := cluster.Labels[KeepUntilLabel]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+
+	t, err := time.Parse(KeepUntilLabelLayout, v)
+	if err != nil {
+		return time.Time{}, true, errors.Wrapf(err, "failed to parse %s value %q", KeepUntilLabel, v)
+	}
+
+	// the cluster is kept through the entire labeled date
+	return t.AddDate(0, 0, 1), true, nil
+}
+
+// parseKeepUntilTimestamp parses an RFC3339 timestamp, or a timestamp or date without UTC offset in the given location.
+// Dates keep the cluster through the entire day.
+func parseKeepUntilTimestamp(v string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{keepUntilLocalTimeLayout, keepUntilLocalMinuteLayout} {
+		if t, err := time.ParseInLocation(layout, v, loc); err == nil {
+			return t, nil
+		}
+	}
+	if t, err := time.ParseInLocation(KeepUntilLabelLayout, v, loc); err == nil {
+		return t.AddDate(0, 0, 1), nil
+	}
+
+	return time.Time{}, errors.Errorf("failed to parse %s value %q, expected a RFC3339 timestamp like %q", KeepUntilAnnotation, v, time.RFC3339)
+}
+
+// Deadline returns when the cluster is going to be deleted, or false if it is not going to be deleted at all.
+// Clusters which are not created yet are assumed to be created now.
+func Deadline(cluster *capi.Cluster, s Settings, c Config, now time.Time) (time.Time, bool) {
+	if _, ok := cluster.Labels[FluxLabel]; ok {
+		return time.Time{}, false
+	}
+	if s.Ignored {
+		return time.Time{}, false
+	}
+
+	created := CreationTime(cluster)
+	if cluster.CreationTimestamp.IsZero() {
+		created = now
+	}
+
+	// the cluster is not deleted before the ignore annotation expires
+	var ignoreUntil time.Time
+	if _, ok := cluster.Annotations[IgnoreAnnotation]; ok {
+		expiry, expires := IgnoreExpiry(cluster, created, c.MaxIgnorePeriod)
+		if !expires {
+			return time.Time{}, false
+		}
+		ignoreUntil = expiry
+	}
+
+	// the cluster is deleted as soon as the deletion was requested and the ignore annotation expired
+	if DeleteNowRequested(cluster) {
+		_, requestedAt := AnnotationManager(cluster, DeleteNowAnnotation)
+		if requestedAt.Before(created) {
+			requestedAt = created
+		}
+		if ignoreUntil.After(requestedAt) {
+			return ignoreUntil, true
+		}
+		return requestedAt, true
+	}
+
+	ttl, hasTTL, err := TTL(cluster)
+	if err == nil && hasTTL {
+		s.TTL = ttl
+	}
+	deadline := created.Add(s.TTL)
+	checkMaxAge := maxAgeApplies(hasTTL, ignoreUntil)
+
+	if ignoreUntil.After(deadline) {
+		deadline = ignoreUntil
+	}
+
+	keepUntilTime, keepUntilSource, err := KeepUntil(cluster)
+	if limit, ok := MaxKeepUntil(cluster, created, c, now); err == nil && ok && keepUntilTime.After(limit) {
+		keepUntilTime = limit
+	}
+	if err != nil {
+		switch c.InvalidKeepUntilBehaviour {
+		case InvalidKeepUntilAbsent:
+			keepUntilSource = ""
+		case InvalidKeepUntilDelete:
+			keepUntilSource = ""
+			checkMaxAge = false
+		default:
+			return time.Time{}, false
+		}
+	}
+
+	if keepUntilSource != "" {
+		if keepUntilTime.After(deadline) {
+			deadline = keepUntilTime
+		}
+		return deadline, true
+	}
+
+	// the cluster exceeds the max age already or before its TTL has passed and is protected from deletion
+	if checkMaxAge && (exceedsMaxAge(created, s, now) || exceedsMaxAge(created, s, deadline)) {
+		return time.Time{}, false
+	}
+
+	return deadline, true
+}
+
+// maxAgeApplies returns true if the cluster is protected from deletion once it is older than the max age. Clusters with
+// a TTL are deleted once it has passed and clusters with an expiring ignore annotation once it expired, regardless of
+// their age, as the annotation expresses how long the cluster is needed.
+func maxAgeApplies(hasTTL bool, ignoreUntil time.Time) bool {
+	return !hasTTL && ignoreUntil.IsZero()
+}
+
+// exceedsMaxAge returns true if the cluster created at the given time is older than the max age of the settings at
+// the given point in time.
+func exceedsMaxAge(created time.Time, s Settings, at time.Time) bool {
+	return s.MaxAge > 0 && at.Sub(created) > s.MaxAge
+}
+
+// MaxKeepUntil returns the latest point in time a `keep-until` value may point to, or false if there is no limit.
+func MaxKeepUntil(cluster *capi.Cluster, created time.Time, c Config, now time.Time) (time.Time, bool) {
+	if c.MaxKeepUntilHorizon <= 0 {
+		return time.Time{}, false
+	}
+
+	basis := created
+	if c.MaxKeepUntilBasis != KeepUntilBasisCreation {
+		observedAt, ok := KeepUntilObservedAt(cluster)
+		if !ok {
+			observedAt = now.Truncate(time.Second)
+		}
+		basis = observedAt
+	}
+
+	return basis.Add(c.MaxKeepUntilHorizon), true
+}
+
+// KeepUntilObservedAt returns when the controller first observed a `keep-until` value on the cluster. Later values do
+// not change it, so the horizon can not be restarted by setting a new value.
+func KeepUntilObservedAt(cluster *capi.Cluster) (time.Time, bool) {
+	observedAt, _, _ := strings.Cut(cluster.Annotations[KeepUntilObservedAnnotation], "/")
+	t, err := time.Parse(time.RFC3339, observedAt)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return t, true
+}
+
+// IgnoreExpiry returns when the ignore annotation of the cluster expires, or false if it never expires.
+// The annotation value can be a duration counted from the creation of the cluster, a date, a RFC3339 timestamp
+// or any other value like `true` for no expiry. The expiry is limited to maxIgnorePeriod after creation if set.
+func IgnoreExpiry(cluster *capi.Cluster, created time.Time, maxIgnorePeriod time.Duration) (time.Time, bool) {
+	expiry, expires := ParseIgnoreExpiry(cluster.Annotations[IgnoreAnnotation], created)
+
+	if maxIgnorePeriod > 0 {
+		maxExpiry := created.Add(maxIgnorePeriod)
+		if !expires || expiry.After(maxExpiry) {
+			return maxExpiry, true
+		}
+	}
+
+	return expiry, expires
+}
+
+// ParseIgnoreExpiry returns when an ignore annotation with the given value expires, or false if it never expires.
+func ParseIgnoreExpiry(v string, created time.Time) (time.Time, bool) {
+	if d, err := time.ParseDuration(v); err == nil {
+		return created.Add(d), true
+	}
+	if t, err := parseKeepUntilTimestamp(v, time.UTC); err == nil {
+		return t, true
+	}
+
+	return time.Time{}, false
+}
+
+// deletionTimeReached returns true once the TTL of the cluster has passed, including the instant it passes.
+func deletionTimeReached(cluster *capi.Cluster, s Settings, now time.Time) bool {
+	return !now.Before(CreationTime(cluster).Add(s.TTL))
+}
+
+// DeleteNowRequested returns true if the immediate deletion of the cluster was requested.
+func DeleteNowRequested(cluster *capi.Cluster) bool {
+	v, ok := cluster.Annotations[DeleteNowAnnotation]
+	return ok && v != "false"
+}
+
+// DeleteNowRequester returns who requested the immediate deletion of the cluster: the user recorded by the mutating
+// webhook, or the field manager which set the annotation if it was not recorded.
+func DeleteNowRequester(cluster *capi.Cluster) string {
+	if requester := cluster.Annotations[DeleteRequestedByAnnotation]; requester != "" {
+		return requester
+	}
+
+	requester, _ := AnnotationManager(cluster, DeleteNowAnnotation)
+	return requester
+}
+
+// AnnotationManager returns the field manager owning the annotation, e.g. `kubectl-annotate`, and when it was set.
+// The creation time of the cluster is returned if the manager is unknown.
+func AnnotationManager(cluster *capi.Cluster, key string) (string, time.Time) {
+	for _, entry := range cluster.ManagedFields {
+		if entry.FieldsV1 == nil {
+			continue
+		}
+
+		var fields struct {
+			Metadata struct {
+				Annotations map[string]json.RawMessage `json:"f:annotations"`
+			} `json:"f:metadata"`
+		}
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err != nil {
+			continue
+		}
+		if _, ok := fields.Metadata.Annotations["f:"+key]; ok && entry.Manager != "" {
+			if entry.Time == nil {
+				return entry.Manager, CreationTime(cluster)
+			}
+			return entry.Manager, entry.Time.UTC()
+		}
+	}
+
+	return "unknown", CreationTime(cluster)
+}
+
+// HasChartAnnotations returns true if the cluster names the App CR it was created from in its chart annotations.
+func HasChartAnnotations(cluster *capi.Cluster) bool {
+	releaseName, nameOK := cluster.Annotations[HelmReleaseNameAnnotation]
+	releaseNamespace, namespaceOK := cluster.Annotations[HelmReleaseNamespaceAnnotation]
+	return nameOK && namespaceOK && releaseName != "" && releaseNamespace != ""
+}
+
+// WarningStages returns the warning stages of the cluster, the earliest first.
+func WarningStages(s Settings, c Config) []time.Duration {
+	stages := append([]time.Duration{s.WarningLeadTime}, c.WarningStages...)
+	stages = slices.DeleteFunc(stages, func(stage time.Duration) bool {
+		return stage <= 0
+	})
+	slices.Sort(stages)
+	slices.Reverse(stages)
+
+	return slices.Compact(stages)
+}
@@ -0,0 +1,99 @@
+package policy
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	capi "sigs.k8s.io/cluster-api/api/core/v1beta2"
+)
+
+func TestKeepUntil(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name           string
+		labels         map[string]string
+		annotations    map[string]string
+		expectedTime   time.Time
+		expectedSource string
+		expectedError  bool
+	}{
+		{
+			name:           "case 0 - no keep-until",
+			expectedSource: "",
+		},
+		{
+			name:           "case 1 - label keeps the entire day",
+			labels:         map[string]string{KeepUntilLabel: "2022-02-01"},
+			expectedTime:   time.Date(2022, 2, 2, 0, 0, 0, 0, time.UTC),
+			expectedSource: KeepUntilLabel,
+		},
+		{
+			name:           "case 2 - annotation with offset",
+			annotations:    map[string]string{KeepUntilAnnotation: "2022-02-01T18:00:00+01:00"},
+			expectedTime:   time.Date(2022, 2, 1, 17, 0, 0, 0, time.UTC),
+			expectedSource: KeepUntilAnnotation,
+		},
+		{
+			name: "case 3 - annotation in time zone",
+			annotations: map[string]string{
+				KeepUntilAnnotation:         "2022-07-01T18:00",
+				KeepUntilTimezoneAnnotation: "Europe/Berlin",
+			},
+			expectedTime:   time.Date(2022, 7, 1, 18, 0, 0, 0, berlin),
+			expectedSource: KeepUntilAnnotation,
+		},
+		{
+			name: "case 4 - annotation date in time zone",
+			annotations: map[string]string{
+				KeepUntilAnnotation:         "2022-07-01",
+				KeepUntilTimezoneAnnotation: "Europe/Berlin",
+			},
+			expectedTime:   time.Date(2022, 7, 2, 0, 0, 0, 0, berlin),
+			expectedSource: KeepUntilAnnotation,
+		},
+		{
+			name:           "case 5 - annotation takes precedence",
+			labels:         map[string]string{KeepUntilLabel: "2099-12-01"},
+			annotations:    map[string]string{KeepUntilAnnotation: "2022-02-01T18:00:00Z"},
+			expectedTime:   time.Date(2022, 2, 1, 18, 0, 0, 0, time.UTC),
+			expectedSource: KeepUntilAnnotation,
+		},
+		{
+			name:           "case 6 - invalid annotation",
+			annotations:    map[string]string{KeepUntilAnnotation: "tomorrow"},
+			expectedSource: KeepUntilAnnotation,
+			expectedError:  true,
+		},
+		{
+			name: "case 7 - invalid time zone",
+			annotations: map[string]string{
+				KeepUntilAnnotation:         "2022-07-01T18:00",
+				KeepUntilTimezoneAnnotation: "Mars/Olympus_Mons",
+			},
+			expectedSource: KeepUntilAnnotation,
+			expectedError:  true,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			cluster := &capi.Cluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:      tc.labels,
+					Annotations: tc.annotations,
+				},
+			}
+
+			keepUntilTime, source, err := KeepUntil(cluster)
+			assert.Equal(t, tc.expectedError, err != nil, "test case %v failed. unexpected error %v", tc.name, err)
+			assert.Equal(t, tc.expectedSource, source, "test case %v failed.", tc.name)
+			assert.True(t, tc.expectedTime.Equal(keepUntilTime), "test case %v failed. expected %v, got %v", tc.name, tc.expectedTime, keepUntilTime)
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package policy
+
+import (
+	"fmt"
+	"time"
+
+	gsapplication "github.com/giantswarm/apiextensions-application/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	capi "sigs.k8s.io/cluster-api/api/core/v1beta2"
+
+	cleanerv1alpha1 "github.com/giantswarm/cluster-cleaner/api/v1alpha1"
+)
+
+// DecisionReason is why a cluster is or is not deleted. It is logged and exposed in the `reason` label of the
+// `cluster_cleaner_decisions_total` metric.
+type DecisionReason string
+
+const (
+	// DecisionDeleting clusters are already being deleted.
+	DecisionDeleting DecisionReason = "Deleting"
+	// DecisionFluxManaged clusters or their App CRs are managed by Flux and never deleted.
+	DecisionFluxManaged DecisionReason = "FluxManaged"
+	// DecisionIgnoreAnnotation clusters have the ignore annotation, they are not deleted before it expires.
+	DecisionIgnoreAnnotation DecisionReason = "IgnoreAnnotation"
+	// DecisionIgnoreRule clusters match an ignore rule of their cleanup policy.
+	DecisionIgnoreRule DecisionReason = "IgnoreRule"
+	// DecisionInvalidKeepUntil clusters have a `keep-until` value which can not be parsed and are ignored until it is
+	// fixed.
+	DecisionInvalidKeepUntil DecisionReason = "InvalidKeepUntil"
+	// DecisionKeepUntil clusters are kept by a `keep-until` value in the future.
+	DecisionKeepUntil DecisionReason = "KeepUntil"
+	// DecisionTooOld clusters are older than the maximum age and have neither a `keep-until` value nor a TTL.
+	DecisionTooOld DecisionReason = "TooOld"
+	// DecisionNoChartAnnotation clusters are due for deletion, but are CAPI-based clusters without the chart
+	// annotations naming their App CR.
+	DecisionNoChartAnnotation DecisionReason = "NoChartAnnotation"
+	// DecisionNoApp clusters are due for deletion, but are CAPI-based clusters whose App CR does not exist.
+	DecisionNoApp DecisionReason = "NoApp"
+	// DecisionPending clusters are going to be deleted, no warning stage was reached yet.
+	DecisionPending DecisionReason = "Pending"
+	// DecisionMarked clusters are marked for deletion, a warning stage was reached.
+	DecisionMarked DecisionReason = "Marked"
+	// DecisionDeleteNow clusters are deleted right away because their deletion was requested.
+	DecisionDeleteNow DecisionReason = "DeleteNow"
+	// DecisionDeleted clusters are deleted because their TTL has passed.
+	DecisionDeleted DecisionReason = "Deleted"
+)
+
+// Decision is what the controller does with a cluster and why.
+type Decision struct {
+	Reason DecisionReason
+	// Settings are the settings the cluster was evaluated with.
+	Settings Settings
+	// Detail explains the reason, e.g. which annotation the cluster is ignored by or who requested its deletion.
+	Detail string
+	// Deadline is the deletion deadline of the cluster shown in the delete-after annotation, zero if it has none.
+	Deadline time.Time
+
+	// IgnoreExpiry is when the ignore annotation expires, zero if it does not or the cluster has none.
+	IgnoreExpiry time.Time
+	// KeepUntil is until when the cluster is kept by its `keep-until` value, clamped to the maximum horizon. It is
+	// zero if the cluster has no valid `keep-until` value or it was not evaluated.
+	KeepUntil time.Time
+	// KeepUntilSource is the label or annotation the `keep-until` value was taken from.
+	KeepUntilSource string
+	// KeepUntilClamped is true if the `keep-until` value was beyond the maximum horizon.
+	KeepUntilClamped bool
+	// InvalidKeepUntil is the error parsing the `keep-until` value, if it was evaluated and can not be parsed.
+	InvalidKeepUntil error
+	// InvalidTTL is the error parsing the TTL of the cluster, if it was evaluated and can not be parsed. The TTL of the
+	// settings is used instead.
+	InvalidTTL error
+}
+
+// Ignored returns true if the cluster is not going to be deleted for now.
+func (d Decision) Ignored() bool {
+	switch d.Reason {
+	case DecisionFluxManaged, DecisionIgnoreAnnotation, DecisionIgnoreRule, DecisionInvalidKeepUntil, DecisionTooOld, DecisionNoChartAnnotation, DecisionNoApp:
+		return true
+	}
+
+	return false
+}
+
+// Related are the objects besides the cluster the rules depend on.
+type Related struct {
+	// Policies are all CleanupPolicies. The default settings apply if none matches the cluster.
+	Policies []cleanerv1alpha1.CleanupPolicy
+	// Namespace is the namespace of the cluster, its labels are matched against the namespace selectors of the
+	// policies. It may be nil if the namespace is unknown.
+	Namespace *corev1.Namespace
+	// App is the App CR named in the chart annotations of a CAPI-based cluster, which is deleted to delete the cluster.
+	// It is nil if the cluster has no App CR, such clusters are not deleted.
+	App *gsapplication.App
+}
+
+// Evaluate decides what to do with the cluster at the given time, with the settings of the CleanupPolicy matching it.
+// An error is returned if the selectors or ignore rules of a policy are invalid.
+func Evaluate(cluster *capi.Cluster, related Related, now time.Time, config Config) (Decision, error) {
+	var namespaceLabels labels.Set
+	if related.Namespace != nil {
+		namespaceLabels = related.Namespace.Labels
+	}
+
+	s, err := ResolveSettings(cluster, related.Policies, namespaceLabels)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	return EvaluateSettings(cluster, related.App, s, now, config), nil
+}
+
+// EvaluateSettings decides what to do with the cluster and its App CR at the given time with already resolved settings.
+func EvaluateSettings(cluster *capi.Cluster, app *gsapplication.App, s Settings, now time.Time, c Config) Decision {
+	d := evaluateSettings(cluster, app, s, now, c)
+
+	// ignored clusters are not going to be deleted, unless their ignore annotation expires
+	if d.Ignored() && d.Reason != DecisionIgnoreAnnotation {
+		d.Deadline = time.Time{}
+	}
+
+	return d
+}
+
+func evaluateSettings(cluster *capi.Cluster, app *gsapplication.App, s Settings, now time.Time, c Config) Decision {
+	d := Decision{Settings: s}
+	if !cluster.DeletionTimestamp.IsZero() {
+		d.Reason = DecisionDeleting
+		return d
+	}
+
+	if deadline, ok := Deadline(cluster, s, c, now); ok {
+		d.Deadline = deadline
+	}
+
+	// ignore GitOps-managed resources
+	if _, ok := cluster.Labels[FluxLabel]; ok {
+		d.Reason = DecisionFluxManaged
+		d.Detail = fmt.Sprintf("it has label %s", FluxLabel)
+		return d
+	}
+	// ensure we're not deleting the cluster app CR of the MC itself
+	if app != nil {
+		if _, ok := app.Labels[FluxLabel]; ok {
+			d.Reason = DecisionFluxManaged
+			d.Detail = fmt.Sprintf("its App CR has label %s", FluxLabel)
+			return d
+		}
+	}
+
+	// ignore cluster from being deleted if ignore annotation is set and has not expired
+	created := CreationTime(cluster)
+	if _, ok := cluster.Annotations[IgnoreAnnotation]; ok {
+		expiry, expires := IgnoreExpiry(cluster, created, c.MaxIgnorePeriod)
+		if !expires {
+			d.Reason = DecisionIgnoreAnnotation
+			d.Detail = fmt.Sprintf("it has annotation %s", IgnoreAnnotation)
+			return d
+		}
+		d.IgnoreExpiry = expiry
+		if now.Before(expiry) {
+			d.Reason = DecisionIgnoreAnnotation
+			d.Detail = fmt.Sprintf("it has annotation %s until %s", IgnoreAnnotation, expiry.Format(time.RFC3339))
+			return d
+		}
+	}
+
+	// ignore cluster from being deleted if an ignore rule of the cleanup policy matches
+	if s.Ignored {
+		d.Reason = DecisionIgnoreRule
+		d.Detail = fmt.Sprintf("it matches an ignore rule of cleanup policy %s", s.Policy)
+		return d
+	}
+
+	// immediately delete the cluster if its deletion was requested, regardless of its TTL and keep-until settings
+	if DeleteNowRequested(cluster) {
+		d.Reason = DecisionDeleteNow
+		d.Detail = DeleteNowRequester(cluster)
+		if reason, detail, ok := undeletable(cluster, app); ok {
+			d.Reason, d.Detail = reason, detail
+		}
+		return d
+	}
+
+	// a TTL set on the cluster itself overrides the TTL of the cleanup policy
+	ttl, hasTTL, err := TTL(cluster)
+	if err != nil {
+		d.InvalidTTL = err
+	} else if hasTTL {
+		s.TTL = ttl
+	}
+
+	checkMaxAge := maxAgeApplies(hasTTL, d.IgnoreExpiry)
+
+	// check if cluster has a keep-until label with a valid ISO date string or annotation with a valid timestamp
+	keepUntilTime, keepUntilSource, err := KeepUntil(cluster)
+	if err != nil {
+		d.InvalidKeepUntil = err
+		switch c.InvalidKeepUntilBehaviour {
+		case InvalidKeepUntilAbsent:
+			keepUntilSource = ""
+		case InvalidKeepUntilDelete:
+			keepUntilSource = ""
+			checkMaxAge = false
+		default:
+			d.Reason = DecisionInvalidKeepUntil
+			d.Detail = "its keep-until value is invalid"
+			return d
+		}
+	}
+
+	if keepUntilSource != "" {
+		// clamp keep-until values beyond the maximum horizon
+		if limit, ok := MaxKeepUntil(cluster, created, c, now); ok && keepUntilTime.After(limit) {
+			d.KeepUntilClamped = true
+			keepUntilTime = limit
+		}
+		d.KeepUntil = keepUntilTime
+		d.KeepUntilSource = keepUntilSource
+
+		if now.Before(keepUntilTime) {
+			d.Reason = DecisionKeepUntil
+			d.Detail = fmt.Sprintf("it has %s until %s", keepUntilSource, keepUntilTime.UTC().Format(time.RFC3339))
+			return d
+		}
+	} else if checkMaxAge && exceedsMaxAge(created, s, now) {
+		// ignore cluster from being deleted if it is older than the max age (7 days by default) and do NOT have keep-until label, annotation or TTL
+		// this is to prevent deletion in a case of accidental deployment of the app to production MCs
+		d.Reason = DecisionTooOld
+		d.Detail = fmt.Sprintf("it is older than %s and does not have %s or %s", s.MaxAge, KeepUntilLabel, ClusterTTL)
+		return d
+	}
+
+	// immediately delete the cluster if the TTL has passed
+	if deletionTimeReached(cluster, s, now) {
+		d.Reason = DecisionDeleted
+		d.Detail = fmt.Sprintf("it has exceeded the time to live (%s)", s.TTL)
+		if reason, detail, ok := undeletable(cluster, app); ok {
+			d.Reason, d.Detail = reason, detail
+		}
+		return d
+	}
+
+	d.Reason = DecisionPending
+	if stages := WarningStages(s, c); !d.Deadline.IsZero() && len(stages) > 0 && !now.Before(d.Deadline.Add(-stages[0])) {
+		d.Reason = DecisionMarked
+	}
+
+	return d
+}
+
+// undeletable returns why the cluster can not be deleted, or false if it can: vintage clusters are deleted themselves,
+// CAPI-based clusters by deleting the App CR named in their chart annotations.
+func undeletable(cluster *capi.Cluster, app *gsapplication.App) (DecisionReason, string, bool) {
+	if _, ok := cluster.Labels[ClusterOperatorVersionLabel]; ok {
+		return "", "", false
+	}
+	if !HasChartAnnotations(cluster) {
+		return DecisionNoChartAnnotation, "it is a CAPI-based cluster without chart annotations", true
+	}
+	if app == nil {
+		return DecisionNoApp, "it is a CAPI-based cluster without App CR", true
+	}
+
+	return "", "", false
+}
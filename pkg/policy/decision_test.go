@@ -0,0 +1,299 @@
+package policy
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	gsapplication "github.com/giantswarm/apiextensions-application/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	capi "sigs.k8s.io/cluster-api/api/core/v1beta2"
+
+	cleanerv1alpha1 "github.com/giantswarm/cluster-cleaner/api/v1alpha1"
+)
+
+func TestEvaluate(t *testing.T) {
+	now := time.Date(2022, 2, 1, 12, 0, 0, 0, time.UTC)
+
+	withAnnotations := func(cluster *capi.Cluster, annotations map[string]string) *capi.Cluster {
+		for k, v := range annotations {
+			cluster.Annotations[k] = v
+		}
+		return cluster
+	}
+	capiCluster := func(created time.Time) *capi.Cluster {
+		cluster := newTestCluster(created, nil)
+		delete(cluster.Labels, ClusterOperatorVersionLabel)
+		return cluster
+	}
+	longLived := cleanerv1alpha1.CleanupPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "long-lived"},
+		Spec: cleanerv1alpha1.CleanupPolicySpec{
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "staging"}},
+			TTL:               &metav1.Duration{Duration: 8 * time.Hour},
+		},
+	}
+	staging := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Labels: map[string]string{"env": "staging"}},
+	}
+	chartAnnotations := map[string]string{HelmReleaseNameAnnotation: "test", HelmReleaseNamespaceAnnotation: "default"}
+	app := func(labels map[string]string) *gsapplication.App {
+		return &gsapplication.App{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default", Labels: labels}}
+	}
+
+	testCases := []struct {
+		name             string
+		cluster          *capi.Cluster
+		related          Related
+		config           Config
+		expectedReason   DecisionReason
+		expectedPolicy   string
+		expectedDeadline time.Time
+		expectedDetail   string
+		expectedError    bool
+	}{
+		{
+			name: "case 0 - deleting",
+			cluster: func() *capi.Cluster {
+				cluster := newTestCluster(now, nil)
+				cluster.DeletionTimestamp = &metav1.Time{Time: now}
+				return cluster
+			}(),
+			expectedReason: DecisionDeleting,
+		},
+		{
+			name:           "case 1 - flux managed",
+			cluster:        newTestCluster(now, map[string]string{FluxLabel: "flux"}),
+			expectedReason: DecisionFluxManaged,
+			expectedDetail: "it has label " + FluxLabel,
+		},
+		{
+			name:           "case 2 - ignore annotation",
+			cluster:        withAnnotations(newTestCluster(now, nil), map[string]string{IgnoreAnnotation: "true"}),
+			expectedReason: DecisionIgnoreAnnotation,
+			expectedDetail: "it has annotation " + IgnoreAnnotation,
+		},
+		{
+			name:             "case 3 - ignore annotation until it expires",
+			cluster:          withAnnotations(newTestCluster(now.Add(-DefaultTTL), nil), map[string]string{IgnoreAnnotation: "6h"}),
+			expectedReason:   DecisionIgnoreAnnotation,
+			expectedDeadline: now.Add(2 * time.Hour),
+			expectedDetail:   "it has annotation " + IgnoreAnnotation + " until 2022-02-01T14:00:00Z",
+		},
+		{
+			name:             "case 4 - expired ignore annotation",
+			cluster:          withAnnotations(newTestCluster(now.Add(-DefaultTTL), nil), map[string]string{IgnoreAnnotation: "2h"}),
+			expectedReason:   DecisionDeleted,
+			expectedDeadline: now,
+			expectedDetail:   "it has exceeded the time to live (4h0m0s)",
+		},
+		{
+			name:    "case 5 - ignore rule",
+			cluster: newTestCluster(now, nil),
+			related: Related{
+				Policies: []cleanerv1alpha1.CleanupPolicy{{
+					ObjectMeta: metav1.ObjectMeta{Name: "production"},
+					Spec: cleanerv1alpha1.CleanupPolicySpec{
+						Ignore: []cleanerv1alpha1.CleanupPolicyIgnoreRule{{Namespaces: []string{"default"}}},
+					},
+				}},
+			},
+			expectedReason: DecisionIgnoreRule,
+			expectedPolicy: "production",
+			expectedDetail: "it matches an ignore rule of cleanup policy production",
+		},
+		{
+			name:             "case 6 - policy selected by namespace labels",
+			cluster:          newTestCluster(now.Add(-DefaultTTL), nil),
+			related:          Related{Policies: []cleanerv1alpha1.CleanupPolicy{longLived}, Namespace: staging},
+			expectedReason:   DecisionPending,
+			expectedPolicy:   "long-lived",
+			expectedDeadline: now.Add(4 * time.Hour),
+		},
+		{
+			name:             "case 7 - policy not selected without namespace",
+			cluster:          newTestCluster(now.Add(-DefaultTTL), nil),
+			related:          Related{Policies: []cleanerv1alpha1.CleanupPolicy{longLived}},
+			expectedReason:   DecisionDeleted,
+			expectedDeadline: now,
+			expectedDetail:   "it has exceeded the time to live (4h0m0s)",
+		},
+		{
+			name:    "case 8 - invalid selector",
+			cluster: newTestCluster(now, nil),
+			related: Related{
+				Policies: []cleanerv1alpha1.CleanupPolicy{{
+					ObjectMeta: metav1.ObjectMeta{Name: "invalid"},
+					Spec: cleanerv1alpha1.CleanupPolicySpec{
+						ClusterSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "not valid"}},
+					},
+				}},
+			},
+			expectedError: true,
+		},
+		{
+			name:             "case 9 - pending",
+			cluster:          newTestCluster(now.Add(-time.Hour), nil),
+			expectedReason:   DecisionPending,
+			expectedDeadline: now.Add(DefaultTTL - time.Hour),
+		},
+		{
+			name:             "case 10 - marked",
+			cluster:          newTestCluster(now.Add(30*time.Minute-DefaultTTL), nil),
+			expectedReason:   DecisionMarked,
+			expectedDeadline: now.Add(30 * time.Minute),
+		},
+		{
+			name:             "case 11 - deleted",
+			cluster:          newTestCluster(now.Add(-DefaultTTL), nil),
+			expectedReason:   DecisionDeleted,
+			expectedDeadline: now,
+			expectedDetail:   "it has exceeded the time to live (4h0m0s)",
+		},
+		{
+			name:             "case 12 - keep-until",
+			cluster:          withAnnotations(newTestCluster(now.Add(-DefaultTTL), nil), map[string]string{KeepUntilAnnotation: "2022-02-02T12:00:00Z"}),
+			expectedReason:   DecisionKeepUntil,
+			expectedDeadline: now.Add(24 * time.Hour),
+			expectedDetail:   "it has " + KeepUntilAnnotation + " until 2022-02-02T12:00:00Z",
+		},
+		{
+			name:             "case 13 - keep-until clamped to the maximum horizon",
+			cluster:          withAnnotations(newTestCluster(now.Add(-DefaultTTL), nil), map[string]string{KeepUntilAnnotation: "2022-02-02T12:00:00Z"}),
+			config:           Config{MaxKeepUntilHorizon: 12 * time.Hour, MaxKeepUntilBasis: KeepUntilBasisCreation},
+			expectedReason:   DecisionKeepUntil,
+			expectedDeadline: now.Add(8 * time.Hour),
+			expectedDetail:   "it has " + KeepUntilAnnotation + " until 2022-02-01T20:00:00Z",
+		},
+		{
+			name:           "case 14 - invalid keep-until",
+			cluster:        newTestCluster(now.Add(-DefaultTTL), map[string]string{KeepUntilLabel: "tomorrow"}),
+			expectedReason: DecisionInvalidKeepUntil,
+			expectedDetail: "its keep-until value is invalid",
+		},
+		{
+			name:             "case 15 - invalid keep-until treated as absent",
+			cluster:          newTestCluster(now.Add(-DefaultTTL), map[string]string{KeepUntilLabel: "tomorrow"}),
+			config:           Config{InvalidKeepUntilBehaviour: InvalidKeepUntilAbsent},
+			expectedReason:   DecisionDeleted,
+			expectedDeadline: now,
+			expectedDetail:   "it has exceeded the time to live (4h0m0s)",
+		},
+		{
+			name:             "case 16 - invalid keep-until deleted regardless of age",
+			cluster:          newTestCluster(now.Add(-DefaultMaxAge-time.Hour), map[string]string{KeepUntilLabel: "tomorrow"}),
+			config:           Config{InvalidKeepUntilBehaviour: InvalidKeepUntilDelete},
+			expectedReason:   DecisionDeleted,
+			expectedDeadline: now.Add(DefaultTTL - DefaultMaxAge - time.Hour),
+			expectedDetail:   "it has exceeded the time to live (4h0m0s)",
+		},
+		{
+			name:           "case 17 - too old",
+			cluster:        newTestCluster(now.Add(-DefaultMaxAge-time.Hour), nil),
+			expectedReason: DecisionTooOld,
+			expectedDetail: "it is older than 168h0m0s and does not have " + KeepUntilLabel + " or " + ClusterTTL,
+		},
+		{
+			name:             "case 18 - expired ignore annotation on a cluster older than the max age",
+			cluster:          withAnnotations(newTestCluster(now.Add(-40*24*time.Hour), nil), map[string]string{IgnoreAnnotation: "240h"}),
+			expectedReason:   DecisionDeleted,
+			expectedDeadline: now.Add(-30 * 24 * time.Hour),
+			expectedDetail:   "it has exceeded the time to live (4h0m0s)",
+		},
+		{
+			name:             "case 19 - ignore annotation capped by the max ignore period on a cluster older than the max age",
+			cluster:          withAnnotations(newTestCluster(now.Add(-40*24*time.Hour), nil), map[string]string{IgnoreAnnotation: "true"}),
+			config:           Config{MaxIgnorePeriod: 720 * time.Hour},
+			expectedReason:   DecisionDeleted,
+			expectedDeadline: now.Add(-10 * 24 * time.Hour),
+			expectedDetail:   "it has exceeded the time to live (4h0m0s)",
+		},
+		{
+			name:           "case 20 - no chart annotation",
+			cluster:        capiCluster(now.Add(-DefaultTTL)),
+			expectedReason: DecisionNoChartAnnotation,
+			expectedDetail: "it is a CAPI-based cluster without chart annotations",
+		},
+		{
+			name: "case 21 - deletion requested",
+			cluster: func() *capi.Cluster {
+				cluster := withAnnotations(newTestCluster(now, nil), map[string]string{DeleteNowAnnotation: "true"})
+				cluster.ManagedFields = []metav1.ManagedFieldsEntry{{
+					Manager:    "kubectl-annotate",
+					Operation:  metav1.ManagedFieldsOperationUpdate,
+					Time:       &metav1.Time{Time: now},
+					FieldsType: "FieldsV1",
+					FieldsV1:   &metav1.FieldsV1{Raw: []byte(`{"f:metadata":{"f:annotations":{"f:` + DeleteNowAnnotation + `":{}}}}`)},
+				}}
+				return cluster
+			}(),
+			expectedReason:   DecisionDeleteNow,
+			expectedDeadline: now,
+			expectedDetail:   "kubectl-annotate",
+		},
+		{
+			name: "case 22 - keep-until clamped from the first observation of another value",
+			cluster: withAnnotations(newTestCluster(now.Add(-DefaultTTL), nil), map[string]string{
+				KeepUntilAnnotation:         "2022-02-02T12:00:00Z",
+				KeepUntilObservedAnnotation: "2022-01-31T12:00:00Z/2022-02-01T00:00:00Z",
+			}),
+			config:           Config{MaxKeepUntilHorizon: 36 * time.Hour, MaxKeepUntilBasis: KeepUntilBasisNow},
+			expectedReason:   DecisionKeepUntil,
+			expectedDeadline: now.Add(12 * time.Hour),
+			expectedDetail:   "it has " + KeepUntilAnnotation + " until 2022-02-02T00:00:00Z",
+		},
+		{
+			name:             "case 23 - app",
+			cluster:          withAnnotations(capiCluster(now.Add(-DefaultTTL)), chartAnnotations),
+			related:          Related{App: app(nil)},
+			expectedReason:   DecisionDeleted,
+			expectedDeadline: now,
+			expectedDetail:   "it has exceeded the time to live (4h0m0s)",
+		},
+		{
+			name:           "case 24 - app managed by flux",
+			cluster:        withAnnotations(capiCluster(now.Add(-DefaultTTL)), chartAnnotations),
+			related:        Related{App: app(map[string]string{FluxLabel: "flux"})},
+			expectedReason: DecisionFluxManaged,
+			expectedDetail: "its App CR has label " + FluxLabel,
+		},
+		{
+			name:           "case 25 - no app",
+			cluster:        withAnnotations(capiCluster(now.Add(-DefaultTTL)), chartAnnotations),
+			expectedReason: DecisionNoApp,
+			expectedDetail: "it is a CAPI-based cluster without App CR",
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			d, err := Evaluate(tc.cluster, tc.related, now, tc.config)
+			assert.Equal(t, tc.expectedError, err != nil, "test case %v failed. unexpected error %v", tc.name, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.expectedReason, d.Reason, "test case %v failed.", tc.name)
+			assert.Equal(t, tc.expectedPolicy, d.Settings.Policy, "test case %v failed.", tc.name)
+			assert.True(t, tc.expectedDeadline.Equal(d.Deadline), "test case %v failed. expected %v, got %v", tc.name, tc.expectedDeadline, d.Deadline)
+			assert.Equal(t, tc.expectedDetail, d.Detail, "test case %v failed.", tc.name)
+		})
+	}
+}
+
+func newTestCluster(creationTimestamp time.Time, labels map[string]string) *capi.Cluster {
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[ClusterOperatorVersionLabel] = "5.1.1"
+
+	return &capi.Cluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "test",
+			Namespace:         "default",
+			CreationTimestamp: metav1.Time{Time: creationTimestamp},
+			Labels:            labels,
+			Annotations:       map[string]string{},
+		},
+	}
+}
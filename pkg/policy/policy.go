@@ -0,0 +1,154 @@
+// Package policy implements the rules deciding whether and when a cluster is deleted by the cluster cleaner. It does
+// not call the API, so tools like CI pipelines and dashboards can apply exactly the same rules as the controller.
+package policy
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// IgnoreAnnotation ignores the cluster for deletion. Its value can be a duration counted from the creation of the
+	// cluster, a date or a RFC3339 timestamp until which the cluster is ignored, or any other value like `true`.
+	IgnoreAnnotation = "alpha.giantswarm.io/ignore-cluster-deletion"
+
+	// KeepUntilLabel is the label keeping the cluster through the given date, e.g. `2022-02-01`.
+	KeepUntilLabel = "keep-until"
+
+	// KeepUntilAnnotation is the annotation keeping the cluster until a precise point in time, e.g. `2022-02-01T18:00:00+01:00`.
+	// It takes precedence over the `keep-until` label.
+	KeepUntilAnnotation = "cluster-cleaner.giantswarm.io/keep-until"
+
+	// KeepUntilTimezoneAnnotation is the IANA time zone, e.g. `Europe/Berlin`, used for `keep-until` annotation
+	// values without an UTC offset.
+	KeepUntilTimezoneAnnotation = "cluster-cleaner.giantswarm.io/keep-until-timezone"
+
+	// KeepUntilObservedAnnotation records when the controller first observed a `keep-until` value and the value as
+	// `<observed at>/<keep until>` RFC3339 timestamps. It is the basis of the maximum keep-until horizon with
+	// KeepUntilBasisNow and is not changed for later values.
+	KeepUntilObservedAnnotation = "cluster-cleaner.giantswarm.io/keep-until-observed"
+
+	// DeleteNowAnnotation requests the immediate deletion of the cluster, skipping its TTL and `keep-until` settings.
+	DeleteNowAnnotation = "cluster-cleaner.giantswarm.io/delete-now"
+
+	// DeleteRequestedByAnnotation is the user who set the DeleteNowAnnotation. It is set by the mutating webhook of the
+	// cluster cleaner.
+	DeleteRequestedByAnnotation = "cluster-cleaner.giantswarm.io/delete-requested-by"
+
+	// ClusterTTL is the label or annotation overriding the time to live of a single cluster, e.g. `12h`.
+	ClusterTTL = "cluster-cleaner.giantswarm.io/ttl"
+
+	// FluxLabel is the label for checking if the cluster is created via git-ops
+	FluxLabel = "kustomize.toolkit.fluxcd.io/name"
+
+	// ClusterOperatorVersionLabel is the label of vintage clusters.
+	ClusterOperatorVersionLabel = "cluster-operator.giantswarm.io/version"
+
+	// HelmReleaseNameAnnotation is the annotation containing the chart release name
+	HelmReleaseNameAnnotation = "meta.helm.sh/release-name"
+
+	// HelmReleaseNamespaceAnnotation is the annotation containing the chart release namespace
+	HelmReleaseNamespaceAnnotation = "meta.helm.sh/release-namespace"
+
+	// DefaultTTL is the default time to live for a cluster.
+	DefaultTTL = 4 * time.Hour
+
+	// DefaultWarningLeadTime is the default time before the deletion when we start sending `ClusterMarkedForDeletion` events.
+	DefaultWarningLeadTime = 1 * time.Hour
+
+	// DefaultMaxAge is the default age after which clusters without `keep-until` label are ignored for deletion.
+	DefaultMaxAge = 7 * 24 * time.Hour
+
+	// KeepUntilLabelLayout is the layout for the `keep-until` label.
+	KeepUntilLabelLayout = "2006-01-02"
+
+	// keepUntilLocalTimeLayout and keepUntilLocalMinuteLayout are the layouts for `keep-until` annotation values
+	// without an UTC offset.
+	keepUntilLocalTimeLayout   = "2006-01-02T15:04:05"
+	keepUntilLocalMinuteLayout = "2006-01-02T15:04"
+)
+
+// InvalidKeepUntilBehaviour defines how clusters with a `keep-until` value which can not be parsed are treated.
+type InvalidKeepUntilBehaviour string
+
+const (
+	// InvalidKeepUntilAbsent treats the cluster as if it had no `keep-until` value.
+	InvalidKeepUntilAbsent InvalidKeepUntilBehaviour = "absent"
+	// InvalidKeepUntilIgnore ignores the cluster for deletion until the value is fixed.
+	InvalidKeepUntilIgnore InvalidKeepUntilBehaviour = "ignore"
+	// InvalidKeepUntilDelete deletes the cluster once its TTL has passed, regardless of its age.
+	InvalidKeepUntilDelete InvalidKeepUntilBehaviour = "delete"
+)
+
+// ParseInvalidKeepUntilBehaviour returns the InvalidKeepUntilBehaviour for the given flag value.
+func ParseInvalidKeepUntilBehaviour(v string) (InvalidKeepUntilBehaviour, error) {
+	switch b := InvalidKeepUntilBehaviour(v); b {
+	case InvalidKeepUntilAbsent, InvalidKeepUntilIgnore, InvalidKeepUntilDelete:
+		return b, nil
+	default:
+		return "", errors.Errorf("invalid keep-until behaviour %q, must be one of %q, %q or %q", v, InvalidKeepUntilAbsent, InvalidKeepUntilIgnore, InvalidKeepUntilDelete)
+	}
+}
+
+// KeepUntilBasis defines from which point in time the maximum keep-until horizon is counted.
+type KeepUntilBasis string
+
+const (
+	// KeepUntilBasisNow counts the horizon from when the `keep-until` value was set.
+	KeepUntilBasisNow KeepUntilBasis = "now"
+	// KeepUntilBasisCreation counts the horizon from the creation of the cluster.
+	KeepUntilBasisCreation KeepUntilBasis = "creation"
+)
+
+// ParseKeepUntilBasis returns the KeepUntilBasis for the given flag value.
+func ParseKeepUntilBasis(v string) (KeepUntilBasis, error) {
+	switch b := KeepUntilBasis(v); b {
+	case KeepUntilBasisNow, KeepUntilBasisCreation:
+		return b, nil
+	default:
+		return "", errors.Errorf("invalid keep-until basis %q, must be one of %q or %q", v, KeepUntilBasisNow, KeepUntilBasisCreation)
+	}
+}
+
+// Config is the configuration of the rules which applies to all clusters.
+type Config struct {
+	// InvalidKeepUntilBehaviour defines how clusters with a `keep-until` value which can not be parsed are treated.
+	// Defaults to InvalidKeepUntilIgnore.
+	InvalidKeepUntilBehaviour InvalidKeepUntilBehaviour
+
+	// MaxIgnorePeriod is how long after their creation clusters may be ignored for deletion with the ignore
+	// annotation. Zero disables the limit.
+	MaxIgnorePeriod time.Duration
+
+	// MaxKeepUntilHorizon is how far after the MaxKeepUntilBasis a `keep-until` value may point. Later values are
+	// clamped. Zero disables the limit.
+	MaxKeepUntilHorizon time.Duration
+
+	// MaxKeepUntilBasis defines from which point in time MaxKeepUntilHorizon is counted. Defaults to KeepUntilBasisNow.
+	MaxKeepUntilBasis KeepUntilBasis
+
+	// WarningStages are the durations before the deletion deadline at which a cluster is marked for deletion, in
+	// addition to the warning lead time of the cleanup policy.
+	WarningStages []time.Duration
+}
+
+// Settings are the cleanup settings which apply to a single cluster, resolved from the CleanupPolicy matching it.
+type Settings struct {
+	// Policy is the name of the CleanupPolicy the settings were resolved from. It is empty if no policy matched.
+	Policy string
+
+	TTL             time.Duration
+	WarningLeadTime time.Duration
+	MaxAge          time.Duration
+	Ignored         bool
+}
+
+// DefaultSettings returns the settings of clusters no CleanupPolicy matches.
+func DefaultSettings() Settings {
+	return Settings{
+		TTL:             DefaultTTL,
+		WarningLeadTime: DefaultWarningLeadTime,
+		MaxAge:          DefaultMaxAge,
+	}
+}
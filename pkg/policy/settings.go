@@ -0,0 +1,110 @@
+package policy
+
+import (
+	"slices"
+	"sort"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	capi "sigs.k8s.io/cluster-api/api/core/v1beta2"
+
+	cleanerv1alpha1 "github.com/giantswarm/cluster-cleaner/api/v1alpha1"
+)
+
+// ResolveSettings returns the settings of the CleanupPolicy with the highest priority matching the cluster in a
+// namespace with the given labels. The default settings are returned if no policy matches.
+func ResolveSettings(cluster *capi.Cluster, policies []cleanerv1alpha1.CleanupPolicy, namespaceLabels labels.Set) (Settings, error) {
+	items := slices.Clone(policies)
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].Spec.Priority != items[j].Spec.Priority {
+			return items[i].Spec.Priority > items[j].Spec.Priority
+		}
+		return items[i].Name < items[j].Name
+	})
+
+	for i := range items {
+		ok, err := Matches(&items[i], cluster, namespaceLabels)
+		if err != nil {
+			return Settings{}, err
+		}
+		if ok {
+			return settingsFromPolicy(&items[i], cluster)
+		}
+	}
+
+	return DefaultSettings(), nil
+}
+
+// Matches returns true if the namespace and cluster selectors of the policy select the cluster in a namespace with
+// the given labels.
+func Matches(policy *cleanerv1alpha1.CleanupPolicy, cluster *capi.Cluster, namespaceLabels labels.Set) (bool, error) {
+	ok, err := selectorMatches(policy.Spec.NamespaceSelector, namespaceLabels)
+	if err != nil {
+		return false, errors.Wrapf(err, "invalid namespace selector in cleanup policy %s", policy.Name)
+	}
+	if !ok {
+		return false, nil
+	}
+
+	ok, err = selectorMatches(policy.Spec.ClusterSelector, cluster.Labels)
+	if err != nil {
+		return false, errors.Wrapf(err, "invalid cluster selector in cleanup policy %s", policy.Name)
+	}
+
+	return ok, nil
+}
+
+func settingsFromPolicy(policy *cleanerv1alpha1.CleanupPolicy, cluster *capi.Cluster) (Settings, error) {
+	s := DefaultSettings()
+	s.Policy = policy.Name
+
+	if policy.Spec.TTL != nil {
+		s.TTL = policy.Spec.TTL.Duration
+	}
+	if policy.Spec.WarningLeadTime != nil {
+		s.WarningLeadTime = policy.Spec.WarningLeadTime.Duration
+	}
+	if policy.Spec.MaxAge != nil {
+		s.MaxAge = policy.Spec.MaxAge.Duration
+	}
+
+	for _, rule := range policy.Spec.Ignore {
+		ignored, err := ignoreRuleMatches(rule, cluster)
+		if err != nil {
+			return Settings{}, errors.Wrapf(err, "invalid ignore rule in cleanup policy %s", policy.Name)
+		}
+		if ignored {
+			s.Ignored = true
+			break
+		}
+	}
+
+	return s, nil
+}
+
+// ignoreRuleMatches returns true if the cluster matches all fields set in the rule. Empty rules never match.
+func ignoreRuleMatches(rule cleanerv1alpha1.CleanupPolicyIgnoreRule, cluster *capi.Cluster) (bool, error) {
+	if len(rule.Namespaces) == 0 && rule.ClusterSelector == nil {
+		return false, nil
+	}
+	if len(rule.Namespaces) > 0 && !slices.Contains(rule.Namespaces, cluster.Namespace) {
+		return false, nil
+	}
+
+	return selectorMatches(rule.ClusterSelector, cluster.Labels)
+}
+
+// selectorMatches returns true if the selector matches the given labels. A nil selector matches everything.
+func selectorMatches(selector *metav1.LabelSelector, set labels.Set) (bool, error) {
+	if selector == nil {
+		return true, nil
+	}
+
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return false, err
+	}
+
+	return s.Matches(set), nil
+}
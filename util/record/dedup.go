@@ -0,0 +1,99 @@
+package record
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/clock"
+)
+
+// DeduplicatingRecorder records an event only once per deduplication window if it is recorded again for the same
+// object with the same type, reason and message, e.g. on every reconciliation of an object. It implements
+// record.EventRecorder.
+type DeduplicatingRecorder struct {
+	recorder record.EventRecorder
+	window   time.Duration
+	clock    clock.PassiveClock
+
+	mu       sync.Mutex
+	recorded map[eventKey]time.Time
+}
+
+type eventKey struct {
+	object    string
+	uid       types.UID
+	eventType string
+	reason    string
+	message   string
+}
+
+// NewDeduplicatingRecorder returns a DeduplicatingRecorder recording the events with the given recorder. Events are
+// not deduplicated if the window is not positive.
+func NewDeduplicatingRecorder(recorder record.EventRecorder, window time.Duration, c clock.PassiveClock) *DeduplicatingRecorder {
+	if c == nil {
+		c = clock.RealClock{}
+	}
+
+	return &DeduplicatingRecorder{
+		recorder: recorder,
+		window:   window,
+		clock:    c,
+		recorded: map[eventKey]time.Time{},
+	}
+}
+
+// Event records the event unless it was recorded within the deduplication window.
+func (r *DeduplicatingRecorder) Event(object runtime.Object, eventType, reason, message string) {
+	if r.duplicate(object, eventType, reason, message) {
+		return
+	}
+	r.recorder.Event(object, eventType, reason, message)
+}
+
+// Eventf is just like Event, but with Sprintf for the message field.
+func (r *DeduplicatingRecorder) Eventf(object runtime.Object, eventType, reason, messageFmt string, args ...interface{}) {
+	r.Event(object, eventType, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+// AnnotatedEventf is just like Eventf, but with annotations attached.
+func (r *DeduplicatingRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventType, reason, messageFmt string, args ...interface{}) {
+	message := fmt.Sprintf(messageFmt, args...)
+	if r.duplicate(object, eventType, reason, message) {
+		return
+	}
+	r.recorder.AnnotatedEventf(object, annotations, eventType, reason, "%s", message)
+}
+
+// duplicate returns true if the event was recorded within the window, and remembers it otherwise. Events older than
+// the window are forgotten, so objects which are gone do not pile up.
+func (r *DeduplicatingRecorder) duplicate(object runtime.Object, eventType, reason, message string) bool {
+	if r.window <= 0 {
+		return false
+	}
+	key := eventKey{object: fmt.Sprintf("%T", object), eventType: eventType, reason: reason, message: message}
+	if accessor, err := meta.Accessor(object); err == nil {
+		key.object += " " + accessor.GetNamespace() + "/" + accessor.GetName()
+		key.uid = accessor.GetUID()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.clock.Now()
+	for k, at := range r.recorded {
+		if now.Sub(at) >= r.window {
+			delete(r.recorded, k)
+		}
+	}
+	if _, ok := r.recorded[key]; ok {
+		return true
+	}
+	r.recorded[key] = now
+
+	return false
+}
@@ -0,0 +1,91 @@
+package record
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	testingclock "k8s.io/utils/clock/testing"
+)
+
+type recordedEvent struct {
+	object    runtime.Object
+	eventType string
+	reason    string
+	message   string
+	after     time.Duration
+}
+
+func TestDeduplicatingRecorder(t *testing.T) {
+	one := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "one", Namespace: "default", UID: "1"}}
+	other := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default", UID: "2"}}
+
+	testCases := []struct {
+		name           string
+		window         time.Duration
+		events         []recordedEvent
+		expectedEvents []string
+	}{
+		{
+			name:   "case 0 - duplicate within the window",
+			window: time.Hour,
+			events: []recordedEvent{
+				{object: one, eventType: corev1.EventTypeWarning, reason: "Failed", message: "boom"},
+				{object: one, eventType: corev1.EventTypeWarning, reason: "Failed", message: "boom", after: 30 * time.Minute},
+			},
+			expectedEvents: []string{"Warning Failed boom"},
+		},
+		{
+			name:   "case 1 - duplicate after the window",
+			window: time.Hour,
+			events: []recordedEvent{
+				{object: one, eventType: corev1.EventTypeWarning, reason: "Failed", message: "boom"},
+				{object: one, eventType: corev1.EventTypeWarning, reason: "Failed", message: "boom", after: time.Hour},
+			},
+			expectedEvents: []string{"Warning Failed boom", "Warning Failed boom"},
+		},
+		{
+			name:   "case 2 - other object, reason or message",
+			window: time.Hour,
+			events: []recordedEvent{
+				{object: one, eventType: corev1.EventTypeWarning, reason: "Failed", message: "boom"},
+				{object: other, eventType: corev1.EventTypeWarning, reason: "Failed", message: "boom"},
+				{object: one, eventType: corev1.EventTypeWarning, reason: "Refused", message: "boom"},
+				{object: one, eventType: corev1.EventTypeWarning, reason: "Failed", message: "bang"},
+			},
+			expectedEvents: []string{"Warning Failed boom", "Warning Failed boom", "Warning Refused boom", "Warning Failed bang"},
+		},
+		{
+			name: "case 3 - deduplication disabled",
+			events: []recordedEvent{
+				{object: one, eventType: corev1.EventTypeNormal, reason: "Marked", message: "soon"},
+				{object: one, eventType: corev1.EventTypeNormal, reason: "Marked", message: "soon"},
+			},
+			expectedEvents: []string{"Normal Marked soon", "Normal Marked soon"},
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			fakeRecorder := record.NewFakeRecorder(10)
+			clock := testingclock.NewFakePassiveClock(time.Date(2022, 2, 1, 12, 0, 0, 0, time.UTC))
+			recorder := NewDeduplicatingRecorder(fakeRecorder, tc.window, clock)
+
+			for _, e := range tc.events {
+				clock.SetTime(clock.Now().Add(e.after))
+				recorder.Eventf(e.object, e.eventType, e.reason, "%s", e.message)
+			}
+			close(fakeRecorder.Events)
+
+			var events []string
+			for event := range fakeRecorder.Events {
+				events = append(events, event)
+			}
+			assert.Equal(t, tc.expectedEvents, events, "test case %v failed.", tc.name)
+		})
+	}
+}